@@ -1,5 +1,45 @@
 DROP TABLE IF EXISTS `sessions`;
 CREATE TABLE `sessions` (
     `id` varchar(200) NOT NULL,
-    `userid` varchar(200) NOT NULL
-) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
+    `userid` int(11) unsigned NOT NULL,
+    `created_at` datetime NOT NULL,
+    `last_seen` datetime NOT NULL,
+    `expires_at` datetime NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY `expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- для уже развернутой базы (старые сессии без сроков сразу считаются истекшими):
+-- ALTER TABLE `sessions` ADD PRIMARY KEY (`id`),
+--   ADD `created_at` datetime NOT NULL DEFAULT '1970-01-01 00:00:01',
+--   ADD `last_seen` datetime NOT NULL DEFAULT '1970-01-01 00:00:01',
+--   ADD `expires_at` datetime NOT NULL DEFAULT '1970-01-01 00:00:01',
+--   ADD KEY `expires_at` (`expires_at`);
+
+-- "выйти везде": токены пользователя, выпущенные не позже revoked_before, отклоняются.
+-- Точность - миллисекунды, как у iat в токенах
+DROP TABLE IF EXISTS `token_revocations`;
+CREATE TABLE `token_revocations` (
+    `userid` int(11) unsigned NOT NULL,
+    `revoked_before` datetime(3) NOT NULL,
+    PRIMARY KEY (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+-- для уже развернутой базы:
+-- ALTER TABLE `token_revocations` MODIFY `revoked_before` datetime(3) NOT NULL;
+
+-- refresh-токены: храним только sha256, used_at - когда токен обменяли на следующий.
+-- Погашенные строки живут до expires_at, чтобы заметить повторное предъявление
+DROP TABLE IF EXISTS `refresh_tokens`;
+CREATE TABLE `refresh_tokens` (
+    `id` char(64) NOT NULL,
+    `family` varchar(64) NOT NULL,
+    `userid` int(11) unsigned NOT NULL,
+    `login` varchar(200) NOT NULL,
+    `created_at` datetime NOT NULL,
+    `expires_at` datetime NOT NULL,
+    `used_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `family` (`family`),
+    KEY `userid` (`userid`),
+    KEY `expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -5,11 +5,26 @@ SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
 
 DROP TABLE IF EXISTS `users`;
 CREATE TABLE `users` (
-  `id` int(11) NOT NULL,
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
   `login` varchar(200) NOT NULL,
   `password` varchar(200) NOT NULL,
-  PRIMARY KEY (`login`)
+  -- user, moderator или admin
+  `role` varchar(20) NOT NULL DEFAULT 'user',
+  -- категории модератора через запятую
+  `categories` varchar(255) NOT NULL DEFAULT '',
+  `disabled` tinyint(1) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `login` (`login`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
-INSERT INTO `users` (`id`, `login`, `password`) VALUES
-(1,	'ayta',	'12345678')
+-- пароль 12345678, bcrypt; старые строки открытым текстом перехешируются при первом входе.
+-- Админов с известным паролем не заводим: роль admin выдается при старте логинам из auth.admins
+-- (или REDDITCLONE_ADMINS)
+INSERT INTO `users` (`id`, `login`, `password`, `role`) VALUES
+(1,	'ayta',	'$2a$12$DSTVTTKgERysBT8bqbffHOMFlfenXurdVMo8uBXSvpGoiHDHrMPZy',	'user');
+
+-- для уже развернутой базы:
+-- ALTER TABLE `users` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`), ADD UNIQUE KEY `login` (`login`),
+--   MODIFY `id` int(11) unsigned NOT NULL AUTO_INCREMENT;
+-- ALTER TABLE `users` ADD `role` varchar(20) NOT NULL DEFAULT 'user',
+--   ADD `categories` varchar(255) NOT NULL DEFAULT '', ADD `disabled` tinyint(1) NOT NULL DEFAULT 0;
@@ -6,127 +6,405 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/config"
 	"redditclone/pkg/handlers"
+	"redditclone/pkg/health"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/jwtkeys"
 	"redditclone/pkg/middleware"
+	"redditclone/pkg/password"
 	"redditclone/pkg/posts"
 	"redditclone/pkg/posts/repo"
+	"redditclone/pkg/ratelimit"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// основные настройки к базе
-	dsn := "root:123456789@tcp(localhost:3306)/golang?"
-	// указываем кодировку
-	dsn += "&charset=utf8"
-	// отказываемся от prapared statements
-	// параметры подставляются сразу
-	dsn += "&interpolateParams=true"
-
-	db, err := sql.Open("mysql", dsn)
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		fmt.Println(err.Error(), " ASDASDA")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	db.SetMaxOpenConns(10)
-
-	err = db.Ping() // вот тут будет первое подключение к базе
+	zapLogger, err := zap.NewProduction()
 	if err != nil {
-		fmt.Println(err.Error(), " HHJFGGF")
+		fmt.Fprintln(os.Stderr, "cant init logger: ", err)
+		os.Exit(1)
 	}
 
-	// основные настройки к базе
-	dsn1 := "root:123456789@tcp(localhost:3306)/golang?"
-	// указываем кодировку
-	dsn1 += "&charset=utf8"
-	// отказываемся от prapared statements
-	// параметры подставляются сразу
-	dsn1 += "&interpolateParams=true"
+	defer zapLogger.Sync()
+	logger := zapLogger.Sugar()
 
-	db1, err := sql.Open("mysql", dsn1)
-	if err != nil {
-		fmt.Println(err.Error(), " ASDASDA")
+	healthHandler := health.NewHandler(cfg.HTTP.HealthTimeout, logger)
+
+	var db *sql.DB
+	if cfg.Storage.NeedsMySQL() {
+		dsn, err := mysqlDSN(cfg.MySQL.DSN)
+		if err != nil {
+			logger.Fatalw("bad mysql dsn", "err", err)
+		}
+		db, err = sql.Open("mysql", dsn)
+		if err != nil {
+			logger.Fatalw("cant open mysql", "err", err)
+		}
+
+		db.SetMaxOpenConns(cfg.MySQL.MaxOpenConns)
+
+		// вот тут будет первое подключение к базе; если база недоступна - стартуем,
+		// но /readyz не пустит на инстанс трафик, пока она не поднимется
+		err = db.Ping()
+		if err != nil {
+			logger.Errorw("cant ping mysql", "err", err)
+		}
+		healthHandler.Add("mysql", health.SQLCheck(db))
+	}
+
+	if cfg.Storage.SnapshotDir != "" {
+		if err = os.MkdirAll(cfg.Storage.SnapshotDir, 0700); err != nil {
+			logger.Fatalw("cant create snapshot dir", "err", err)
+		}
+	}
+
+	var client *mongo.Client
+	var postRepo posts.PostRepo
+	var revisionRepo posts.RevisionRepo
+	var postIDs idgen.Generator
+	if cfg.Storage.PostIDs == config.PostIDULID {
+		postIDs = idgen.NewULID()
 	}
+	switch cfg.Storage.Posts {
+	case config.BackendMemory:
+		postRepo = posts.NewInMemoryRepo()
+		revisionRepo = posts.NewRevisionInMemoryRepo()
+		if postIDs == nil {
+			postIDs = idgen.NewSequence(0)
+		}
+	default:
+		client, err = mongo.Connect(context.TODO(), options.Client().ApplyURI(cfg.Mongo.URI))
+		if err != nil {
+			logger.Fatalw("cant connect to mongo", "err", err)
+		}
 
-	db1.SetMaxOpenConns(10)
+		// если коллекции не будет, то она создасться автоматически
+		collection := client.Database(cfg.Mongo.Database).Collection(cfg.Mongo.Collection)
+		mongoPosts := posts.NewMemoryRepo(collection)
+		postRepo = mongoPosts
+		healthHandler.Add("mongo", health.MongoCheck(collection))
 
-	err = db1.Ping() // вот тут будет первое подключение к базе
-	if err != nil {
-		fmt.Println(err.Error(), " HHJFGGF")
+		if err = mongoPosts.EnsureIndexes(context.TODO()); err != nil {
+			logger.Fatalw("cant create post indexes", "err", err)
+		}
+		var migrated int64
+		if migrated, err = mongoPosts.BackfillCreated(context.TODO()); err != nil {
+			logger.Fatalw("cant backfill post dates", "err", err)
+		}
+		if migrated > 0 {
+			logger.Infow("backfilled post dates", "posts", migrated)
+		}
+
+		revisions := posts.NewRevisionMongoRepo(client.Database(cfg.Mongo.Database).Collection(cfg.Mongo.RevisionsCollection))
+		if err = revisions.EnsureIndexes(context.TODO()); err != nil {
+			logger.Fatalw("cant create revision indexes", "err", err)
+		}
+		revisionRepo = revisions
+
+		if postIDs == nil {
+			counters := client.Database(cfg.Mongo.Database).Collection(cfg.Mongo.CountersCollection)
+			postIDs, err = idgen.NewMongoCounter(counters, cfg.Mongo.Collection, collection)
+			if err != nil {
+				logger.Fatalw("cant init post id counter", "err", err)
+			}
+		}
 	}
+	logger.Infow("posts storage", "backend", cfg.Storage.Posts, "ids", cfg.Storage.PostIDs)
 
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	keys, err := signingKeys(cfg.Auth)
 	if err != nil {
-		panic(err)
+		logger.Fatalw("cant load signing keys", "err", err)
 	}
+	logger.Infow("token signing", "kid", keys.SigningKID())
 
-	// если коллекции не будет, то она создасться автоматически
-	collection := client.Database("sample_training").Collection("posts")
+	lifetime := session.Lifetime{
+		Max:     cfg.Session.CookieTTL,
+		Idle:    cfg.Session.IdleTimeout,
+		Refresh: cfg.Auth.RefreshTTL,
+	}
+	var sessionManager interface {
+		session.SessionRepo
+		session.RefreshRepo
+		session.Purger
+	}
+	switch cfg.Storage.Sessions {
+	case config.BackendMemory:
+		sessionManager, err = session.NewSessionsInMemoryManager(lifetime, snapshotPath(cfg, "sessions.json"))
+		if err != nil {
+			logger.Fatalw("cant load sessions", "err", err)
+		}
+	default:
+		sessionManager = session.NewSessionsManager(db, lifetime)
+	}
 
-	zapLogger, _ := zap.NewProduction()
+	// чистильщик сессий останавливаем до закрытия базы, которой он пользуется
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	janitorDone := make(chan struct{})
+	go func() {
+		session.RunJanitor(janitorCtx, sessionManager, cfg.Session.CleanupInterval, logger)
+		close(janitorDone)
+	}()
 
-	defer zapLogger.Sync()
-	logger := zapLogger.Sugar()
+	hasher, err := password.New(cfg.Auth.PasswordHash, cfg.Auth.BcryptCost)
+	if err != nil {
+		logger.Fatalw("cant init password hasher", "err", err)
+	}
+
+	var userRepo user.UsersRepo
+	switch cfg.Storage.Users {
+	case config.BackendMemory:
+		userRepo, err = user.NewInMemoryRepo(snapshotPath(cfg, "users.json"), hasher)
+		if err != nil {
+			logger.Fatalw("cant load users", "err", err)
+		}
+	default:
+		userRepo = user.NewMemoryRepo(db, hasher)
+	}
+	bootstrapAdmins(userRepo, cfg.Auth.Admins, logger)
+	logger.Infow("users storage",
+		"users", cfg.Storage.Users,
+		"sessions", cfg.Storage.Sessions,
+		"standalone", cfg.Storage.Standalone(),
+	)
 
-	sessionManager := session.NewSessionsManager(db1)
-	userRepo := user.NewMemoryRepo(db)
 	userHandler := &handlers.UserHandler{
 		UserRepo:       userRepo,
 		Logger:         logger,
 		SessionManager: sessionManager,
+		RefreshTokens:  sessionManager,
+		Keys:           keys,
+		TokenTTL:       cfg.Auth.TokenTTL,
 	}
+	if rl := cfg.RateLimit; rl.Enabled {
+		userHandler.Guard = ratelimit.NewGuard(ratelimit.NewMemoryStore(),
+			ratelimit.Rate{Burst: rl.IPBurst, Every: rl.IPInterval},
+			ratelimit.Rate{Burst: rl.AccountBurst, Every: rl.AccountInterval},
+			ratelimit.Lockout{
+				Threshold: rl.LockoutThreshold,
+				Base:      rl.LockoutBase,
+				Max:       rl.LockoutMax,
+				Window:    rl.LockoutWindow,
+			},
+			rl.TrustForwarded,
+		)
+	}
+	logger.Infow("login rate limit", "enabled", cfg.RateLimit.Enabled, "trust_forwarded", cfg.RateLimit.TrustForwarded)
 
-	postRepo := posts.NewMemoryRepo(collection)
-	Repo := repo.MyRepo{Db: postRepo}
-	postHandler := &handlers.PostsHandler{
-		PostRepo:       Repo,
+	adminHandler := &handlers.AdminHandler{
+		UserRepo:       userRepo,
 		Logger:         logger,
 		SessionManager: sessionManager,
+		RefreshTokens:  sessionManager,
+	}
+
+	Repo := repo.MyRepo{Db: postRepo, IDs: postIDs}
+	postHandler := &handlers.PostsHandler{
+		PostRepo:        Repo,
+		Logger:          logger,
+		SessionManager:  sessionManager,
+		RevisionRepo:    revisionRepo,
+		TitleEditWindow: cfg.Posts.TitleEditWindow,
+		Retention:       cfg.Posts.Retention,
+	}
+
+	// очистка удаленных постов живет столько же, сколько чистильщик сессий
+	purgerDone := make(chan struct{})
+	go func() {
+		posts.RunPurger(janitorCtx, &Repo, revisionRepo, cfg.Posts.Retention, cfg.Posts.PurgeInterval, logger)
+		close(purgerDone)
+	}()
+
+	authn := &middleware.Authenticator{
+		Keys:           keys,
+		Sessions:       sessionManager,
+		RequireSession: cfg.Auth.RequireSession,
+		Logger:         logger,
 	}
 
 	r := mux.NewRouter()
+	// формат id зависит от генератора: числа или ULID
+	postID := "{POST_ID:" + postIDs.Pattern() + "}"
+
+	r.HandleFunc("/healthz", healthHandler.Live).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Ready).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", keys.ServeJWKS).Methods("GET")
 
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))))
-	r.Handle("/", http.FileServer(http.Dir("static/html/")))
+	staticDir := cfg.HTTP.StaticDir
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir))))
+	r.Handle("/", http.FileServer(http.Dir(filepath.Join(staticDir, "html"))))
 
 	r.HandleFunc("/api/register", userHandler.Register).Methods("POST")
 	r.HandleFunc("/api/login", userHandler.Login).Methods("POST")
+	r.HandleFunc("/api/token/refresh", userHandler.Refresh).Methods("POST")
+	r.HandleFunc("/api/logout", userHandler.Logout).Methods("POST")
+	r.HandleFunc("/api/logout/all", authn.Auth(userHandler.LogoutAll)).Methods("POST")
 
-	r.HandleFunc("/api/posts", middleware.Auth(postHandler.Add)).Methods("POST")
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}", middleware.Auth(postHandler.AddComment)).Methods("POST")
+	adminUser := "/api/admin/users/{USER_ID:[0-9]+}"
+	r.HandleFunc("/api/admin/users", authn.RequireRole(adminHandler.ListUsers, authz.RoleAdmin)).Methods("GET")
+	r.HandleFunc(adminUser+"/role", authn.RequireRole(adminHandler.SetRole, authz.RoleAdmin)).Methods("PUT")
+	r.HandleFunc(adminUser+"/disable", authn.RequireRole(adminHandler.Disable, authz.RoleAdmin)).Methods("POST")
+	r.HandleFunc(adminUser+"/enable", authn.RequireRole(adminHandler.Enable, authz.RoleAdmin)).Methods("POST")
+	r.HandleFunc(adminUser+"/logout", authn.RequireRole(adminHandler.Logout, authz.RoleAdmin)).Methods("POST")
+
+	r.HandleFunc("/api/posts", authn.Auth(postHandler.Add)).Methods("POST")
+	r.HandleFunc("/api/post/"+postID, authn.Auth(postHandler.AddComment)).Methods("POST")
 
 	r.HandleFunc("/api/posts/", postHandler.GetAllPosts).Methods("GET")
 	r.HandleFunc("/api/posts/{CATEGORY_NAME}", postHandler.GetCategory).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}", postHandler.GetPost).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}/upvote", middleware.Auth(postHandler.Upvote)).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}/unvote", middleware.Auth(postHandler.Unvote)).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}/downvote", middleware.Auth(postHandler.Downvote)).Methods("GET")
-	r.HandleFunc("/api/user/{USER_LOGIN}", postHandler.GetUserPost).Methods("GET")
-
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}/{COMMENT_ID:[0-9]+}", postHandler.DeleteComment).Methods("DELETE")
-	r.HandleFunc("/api/post/{POST_ID:[0-9]+}", postHandler.Delete).Methods("DELETE")
-	r.NotFoundHandler = http.HandlerFunc(NotHandler)
+	r.HandleFunc("/api/post/"+postID, postHandler.GetPost).Methods("GET")
+	r.HandleFunc("/api/post/"+postID, authn.Auth(postHandler.Edit)).Methods("PUT", "PATCH")
+	r.HandleFunc("/api/post/"+postID+"/revisions", postHandler.Revisions).Methods("GET")
+	r.HandleFunc("/api/post/"+postID+"/upvote", authn.Auth(postHandler.Upvote)).Methods("GET")
+	r.HandleFunc("/api/post/"+postID+"/unvote", authn.Auth(postHandler.Unvote)).Methods("GET")
+	r.HandleFunc("/api/post/"+postID+"/downvote", authn.Auth(postHandler.Downvote)).Methods("GET")
+	r.HandleFunc("/api/user/{USER_LOGIN}", authn.Auth(postHandler.GetUserPost)).Methods("GET")
+
+	r.HandleFunc("/api/post/"+postID+"/{COMMENT_ID:[0-9]+}", authn.Auth(postHandler.DeleteComment)).Methods("DELETE")
+	r.HandleFunc("/api/post/"+postID, authn.Auth(postHandler.Delete)).Methods("DELETE")
+	r.HandleFunc("/api/post/"+postID+"/{COMMENT_ID:[0-9]+}/restore", authn.Auth(postHandler.RestoreComment)).Methods("POST")
+	r.HandleFunc("/api/post/"+postID+"/restore", authn.Auth(postHandler.RestorePost)).Methods("POST")
+	r.NotFoundHandler = NotHandler(filepath.Join(staticDir, "html", "index.html"))
 	//mux := middleware.Auth(r)
 
-	addr := ":8080"
-	logger.Infow("starting server",
-		"type", "START",
-		"addr", addr,
-	)
+	srv := &http.Server{
+		Addr:         cfg.HTTP.Addr,
+		Handler:      r,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
+	}
 
-	fmt.Println("starting server at :8080")
-	http.ListenAndServe(":8080", r)
+	// ловим SIGINT/SIGTERM, чтобы дать текущим запросам (например голосованиям) доработать
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Infow("starting server",
+			"type", "START",
+			"addr", srv.Addr,
+		)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorw("server stopped", "err", err)
+		}
+	case <-ctx.Done():
+		logger.Infow("shutting down server",
+			"type", "STOP",
+			"timeout", cfg.HTTP.ShutdownTimeout,
+		)
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	// порядок важен: сначала перестаем принимать запросы и дожидаемся текущих,
+	// потом закрываем базы, которыми эти запросы пользуются
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		logger.Errorw("cant drain in-flight requests", "err", err)
+	}
+	stopJanitor()
+	<-janitorDone
+	<-purgerDone
+	if db != nil {
+		if err = db.Close(); err != nil {
+			logger.Errorw("cant close mysql", "err", err)
+		}
+	}
+	if client != nil {
+		if err = client.Disconnect(shutdownCtx); err != nil {
+			logger.Errorw("cant disconnect mongo", "err", err)
+		}
+	}
+	logger.Infow("server stopped", "type", "STOP")
 }
 
-func NotHandler(w http.ResponseWriter, r *http.Request) {
-	data, _ := ioutil.ReadFile("static/html/index.html")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+// mysqlDSN включает parseTime, без него даты сессий не читаются в time.Time
+func mysqlDSN(dsn string) (string, error) {
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	mysqlCfg.ParseTime = true
+	mysqlCfg.Loc = time.UTC
+	return mysqlCfg.FormatDSN(), nil
+}
+
+// signingKeys - ключи из файлов и, если задан, общий секрет без kid: им подписываем только
+// когда асимметричных ключей нет, а с ними он лишь принимает старые токены
+func signingKeys(cfg config.AuthConfig) (*jwtkeys.KeySet, error) {
+	var keys []*jwtkeys.Key
+	for _, k := range cfg.SigningKeys {
+		key, err := jwtkeys.LoadFile(k.KID, k.Alg, k.PrivateKey, k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if cfg.TokenSecret != "" {
+		keys = append(keys, jwtkeys.NewHMAC("", []byte(cfg.TokenSecret)))
+	}
+	return jwtkeys.NewKeySet(cfg.SigningKID, keys...)
+}
+
+// bootstrapAdmins выдает роль admin логинам из конфига, иначе первого админа не назначить.
+// Пользователя еще нет - просто предупреждаем, он получит роль при следующем старте
+func bootstrapAdmins(users user.UsersRepo, logins []string, logger *zap.SugaredLogger) {
+	for _, login := range logins {
+		u, err := users.FindUser(login)
+		if err != nil {
+			logger.Warnw("admin from config not found", "login", login, "err", err)
+			continue
+		}
+		if u.Role == authz.RoleAdmin {
+			continue
+		}
+		if _, err = users.SetRole(u.ID, authz.RoleAdmin, nil); err != nil {
+			logger.Errorw("cant grant admin role", "login", login, "err", err)
+			continue
+		}
+		logger.Infow("admin role granted", "login", login)
+	}
+}
+
+// snapshotPath - файл снимка in-memory хранилища, пусто если снимки выключены
+func snapshotPath(cfg *config.Config, name string) string {
+	if cfg.Storage.SnapshotDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.Storage.SnapshotDir, name)
+}
+
+func NotHandler(indexPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadFile(indexPath)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}
 }
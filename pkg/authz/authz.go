@@ -0,0 +1,120 @@
+// Package authz решает, может ли пользователь менять контент. Кто он такой, уже установил
+// middleware.Auth: нет пользователя - 401, есть, но нельзя - 403
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"redditclone/pkg/comments"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/session"
+)
+
+const (
+	RoleUser = "user"
+	// RoleModerator управляет контентом в своих категориях
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var ErrForbidden = errors.New(" forbidden")
+
+// ValidRole - роль из известного набора
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// HasRole - пользователь с одной из ролей roles
+func HasRole(p *session.Principal, roles ...string) error {
+	if p == nil {
+		return session.ErrNoAuth
+	}
+	for _, role := range roles {
+		if p.Role == role {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// CanModifyPost - удалять пост может автор, модератор его категории и админ
+func CanModifyPost(p *session.Principal, post *posts.Post) error {
+	if p == nil {
+		return session.ErrNoAuth
+	}
+	if isAuthor(p, post.CreatedBy.ID) || canModerate(p, post.Category) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CanEditPost - менять содержимое поста может только автор: модератор и админ
+// удаляют чужое, но не пишут от чужого имени
+func CanEditPost(p *session.Principal, post *posts.Post) error {
+	if p == nil {
+		return session.ErrNoAuth
+	}
+	if isAuthor(p, post.CreatedBy.ID) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CanModifyComment - то же для комментария: автор комментария, модератор категории поста и админ.
+// Автор поста чужие комментарии под ним не удаляет
+func CanModifyComment(p *session.Principal, post *posts.Post, c *comments.Comment) error {
+	if p == nil {
+		return session.ErrNoAuth
+	}
+	if isAuthor(p, c.CreatedBy.ID) || canModerate(p, post.Category) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CanRestorePost - вернуть удаленный пост может модератор категории и админ,
+// автор - только если удалял сам, а не модератор. Неудаленный пост автору виден и так,
+// поэтому ему можно, а хендлер ответит, что восстанавливать нечего
+func CanRestorePost(p *session.Principal, post *posts.Post) error {
+	if p == nil {
+		return session.ErrNoAuth
+	}
+	if canModerate(p, post.Category) || deletedByAuthor(p, post.CreatedBy.ID, post.DeletedBy) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CanRestoreComment - то же для комментария
+func CanRestoreComment(p *session.Principal, post *posts.Post, c *comments.Comment) error {
+	if p == nil {
+		return session.ErrNoAuth
+	}
+	if canModerate(p, post.Category) || deletedByAuthor(p, c.CreatedBy.ID, c.DeletedBy) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+func deletedByAuthor(p *session.Principal, authorID string, deletedBy *forms.UserForm) bool {
+	return isAuthor(p, authorID) && (deletedBy == nil || deletedBy.ID == authorID)
+}
+
+func isAuthor(p *session.Principal, authorID string) bool {
+	return authorID == fmt.Sprint(p.UserID)
+}
+
+func canModerate(p *session.Principal, category string) bool {
+	switch p.Role {
+	case RoleAdmin:
+		return true
+	case RoleModerator:
+		for _, c := range p.Categories {
+			if c == category {
+				return true
+			}
+		}
+	}
+	return false
+}
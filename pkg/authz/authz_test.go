@@ -0,0 +1,106 @@
+package authz
+
+import (
+	"redditclone/pkg/comments"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/session"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	post := &posts.Post{ID: "1", Category: "music", CreatedBy: forms.UserForm{ID: "1", Login: "ata"}}
+	comment := &comments.Comment{ID: "1", CreatedBy: forms.UserForm{ID: "3", Login: "rita"}}
+
+	author := &session.Principal{UserID: 1, Role: RoleUser}
+	commenter := &session.Principal{UserID: 3, Role: RoleUser}
+	stranger := &session.Principal{UserID: 2, Role: RoleUser}
+	moderator := &session.Principal{UserID: 4, Role: RoleModerator, Categories: []string{"news", "music"}}
+	otherModerator := &session.Principal{UserID: 5, Role: RoleModerator, Categories: []string{"news"}}
+	admin := &session.Principal{UserID: 6, Role: RoleAdmin}
+	// категории без роли модератора ничего не дают
+	fake := &session.Principal{UserID: 7, Role: RoleUser, Categories: []string{"music"}}
+
+	cases := []struct {
+		name    string
+		p       *session.Principal
+		post    error
+		comment error
+		// править пост может только автор
+		edit error
+	}{
+		{"anonymous", nil, session.ErrNoAuth, session.ErrNoAuth, session.ErrNoAuth},
+		{"post author", author, nil, ErrForbidden, nil},
+		{"comment author", commenter, ErrForbidden, nil, ErrForbidden},
+		{"stranger", stranger, ErrForbidden, ErrForbidden, ErrForbidden},
+		{"moderator", moderator, nil, nil, ErrForbidden},
+		{"other moderator", otherModerator, ErrForbidden, ErrForbidden, ErrForbidden},
+		{"admin", admin, nil, nil, ErrForbidden},
+		{"categories without role", fake, ErrForbidden, ErrForbidden, ErrForbidden},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.post, CanModifyPost(c.p, post), c.name)
+		assert.Equal(t, c.comment, CanModifyComment(c.p, post, comment), c.name)
+		assert.Equal(t, c.edit, CanEditPost(c.p, post), c.name)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ata := forms.UserForm{ID: "1", Login: "ata"}
+	rita := forms.UserForm{ID: "3", Login: "rita"}
+	mod := forms.UserForm{ID: "4", Login: "mod"}
+	author := &session.Principal{UserID: 1, Role: RoleUser}
+	commenter := &session.Principal{UserID: 3, Role: RoleUser}
+	moderator := &session.Principal{UserID: 4, Role: RoleModerator, Categories: []string{"music"}}
+	otherModerator := &session.Principal{UserID: 5, Role: RoleModerator, Categories: []string{"news"}}
+	admin := &session.Principal{UserID: 6, Role: RoleAdmin}
+
+	cases := []struct {
+		name      string
+		p         *session.Principal
+		deletedBy forms.UserForm
+		post      error
+		comment   error
+	}{
+		{"anonymous", nil, ata, session.ErrNoAuth, session.ErrNoAuth},
+		{"author deleted own", author, ata, nil, ErrForbidden},
+		{"commenter deleted own", commenter, rita, ErrForbidden, nil},
+		// снятое модератором автор обратно не возвращает
+		{"author after moderator", author, mod, ErrForbidden, ErrForbidden},
+		{"commenter after moderator", commenter, mod, ErrForbidden, ErrForbidden},
+		{"moderator", moderator, ata, nil, nil},
+		{"other moderator", otherModerator, mod, ErrForbidden, ErrForbidden},
+		{"admin", admin, mod, nil, nil},
+	}
+	for _, c := range cases {
+		by := c.deletedBy
+		post := &posts.Post{ID: "1", Category: "music", CreatedBy: ata, DeletedBy: &by}
+		comment := &comments.Comment{ID: "1", CreatedBy: rita, DeletedBy: &by}
+		assert.Equal(t, c.post, CanRestorePost(c.p, post), c.name)
+		assert.Equal(t, c.comment, CanRestoreComment(c.p, post, comment), c.name)
+	}
+
+	// неудаленное автору можно, постороннему - нет
+	post := &posts.Post{ID: "1", Category: "music", CreatedBy: ata}
+	comment := &comments.Comment{ID: "1", CreatedBy: rita}
+	assert.NoError(t, CanRestorePost(author, post))
+	assert.NoError(t, CanRestoreComment(commenter, post, comment))
+	assert.Equal(t, ErrForbidden, CanRestorePost(commenter, post))
+	assert.Equal(t, ErrForbidden, CanRestoreComment(author, post, comment))
+}
+
+func TestHasRole(t *testing.T) {
+	admin := &session.Principal{UserID: 1, Role: RoleAdmin}
+	moderator := &session.Principal{UserID: 2, Role: RoleModerator}
+
+	assert.Equal(t, session.ErrNoAuth, HasRole(nil, RoleAdmin))
+	assert.NoError(t, HasRole(admin, RoleAdmin))
+	assert.Equal(t, ErrForbidden, HasRole(moderator, RoleAdmin))
+	assert.NoError(t, HasRole(moderator, RoleModerator, RoleAdmin))
+
+	assert.True(t, ValidRole(RoleModerator))
+	assert.False(t, ValidRole("root"))
+	assert.False(t, ValidRole(""))
+}
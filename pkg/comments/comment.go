@@ -1,13 +1,39 @@
 package comments
 
 import (
+	"encoding/json"
 	"redditclone/pkg/forms"
+	"time"
 )
 
+// DeletedPlaceholder заменяет текст и автора удаленного комментария в ответах
+const DeletedPlaceholder = "[deleted]"
+
+// Comment хранится внутри поста. Ключи в монге - имена полей в нижнем регистре
 type Comment struct {
 	ID          string         `json:"id"`
 	Description string         `json:"body"`
-	CurrentTime string         `json:"created"`
+	CreatedAt   time.Time      `json:"created"`
+	EditedAt    *time.Time     `json:"edited,omitempty"`
 	CreatedBy   forms.UserForm `json:"author"`
 	PostID      string         `json:"postId"`
+	// удаленный комментарий остается в треде заглушкой до очистки
+	DeletedAt    *time.Time      `json:"deleted,omitempty"`
+	DeletedBy    *forms.UserForm `json:"-"`
+	DeleteReason string          `json:"-"`
+}
+
+func (c *Comment) Deleted() bool {
+	return c.DeletedAt != nil
+}
+
+// MarshalJSON прячет текст и автора удаленного комментария, в хранилище они остаются для восстановления
+func (c Comment) MarshalJSON() ([]byte, error) {
+	type plain Comment
+	if c.Deleted() {
+		c.Description = DeletedPlaceholder
+		c.CreatedBy = forms.UserForm{Login: DeletedPlaceholder}
+		c.EditedAt = nil
+	}
+	return json.Marshal(plain(c))
 }
@@ -1,7 +1,6 @@
 package comments
 
 import (
-	"fmt"
 	"strconv"
 	"sync"
 )
@@ -31,26 +30,3 @@ func (repo *CommentMemoryRepository) Add(Comment *Comment) string {
 	//repo.mu.RUnlock()
 	return Comment.ID
 }
-
-func Delete(data []Comment, id string) ([]Comment, bool) {
-	i := -1
-	for idx, comment := range data {
-		if comment.ID != id {
-			continue
-		}
-		i = idx
-	}
-	if i < 0 {
-		return data, false
-	}
-	fmt.Println("i  -", i)
-	if i < len(data)-1 {
-		//repo.mu.RLock()
-		copy(data[i:], data[i+1:])
-		//repo.mu.RUnlock()
-	}
-	//repo.mu.RLock()
-	data = data[:len(data)-1]
-	//repo.mu.RUnlock()
-	return data, true
-}
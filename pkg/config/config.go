@@ -0,0 +1,503 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"redditclone/pkg/jwtkeys"
+	"redditclone/pkg/password"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// префикс переменных окружения, например REDDITCLONE_MYSQL_DSN
+const envPrefix = "REDDITCLONE_"
+
+// хранилища, которые можно выбрать в секции storage
+const (
+	BackendMongo  = "mongo"
+	BackendMySQL  = "mysql"
+	BackendMemory = "memory"
+)
+
+// способы выдачи id постов
+const (
+	// PostIDCounter - последовательные числа, в монге через коллекцию счетчиков
+	PostIDCounter = "counter"
+	// PostIDULID - ULID, не требуют общего состояния
+	PostIDULID = "ulid"
+)
+
+type Config struct {
+	HTTP      HTTPConfig      `yaml:"http"`
+	Storage   StorageConfig   `yaml:"storage"`
+	MySQL     MySQLConfig     `yaml:"mysql"`
+	Mongo     MongoConfig     `yaml:"mongo"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Session   SessionConfig   `yaml:"session"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Posts     PostsConfig     `yaml:"posts"`
+}
+
+type HTTPConfig struct {
+	Addr            string        `yaml:"addr"`
+	StaticDir       string        `yaml:"static_dir"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	HealthTimeout   time.Duration `yaml:"health_timeout"`
+}
+
+type StorageConfig struct {
+	Posts    string `yaml:"posts"`
+	Users    string `yaml:"users"`
+	Sessions string `yaml:"sessions"`
+	PostIDs  string `yaml:"post_ids"`
+	// каталог для снимков in-memory хранилищ, пусто - без сохранения на диск
+	SnapshotDir string `yaml:"snapshot_dir"`
+}
+
+// Standalone - всё хранится в памяти процесса, внешние базы не нужны
+func (s StorageConfig) Standalone() bool {
+	return s.Posts == BackendMemory && s.Users == BackendMemory && s.Sessions == BackendMemory
+}
+
+func (s StorageConfig) NeedsMySQL() bool {
+	return s.Users == BackendMySQL || s.Sessions == BackendMySQL
+}
+
+type MySQLConfig struct {
+	DSN          string `yaml:"dsn"`
+	MaxOpenConns int    `yaml:"max_open_conns"`
+}
+
+type MongoConfig struct {
+	URI        string `yaml:"uri"`
+	Database   string `yaml:"database"`
+	Collection string `yaml:"collection"`
+	// коллекция счетчиков для post_ids: counter
+	CountersCollection string `yaml:"counters_collection"`
+	// история правок постов
+	RevisionsCollection string `yaml:"revisions_collection"`
+}
+
+type AuthConfig struct {
+	// общий секрет HS256. С signing_keys нужен только чтобы принимать старые токены без kid
+	TokenSecret string `yaml:"token_secret"`
+	// асимметричные ключи, подписывает signing_kid, остальные только проверяют
+	SigningKeys []SigningKeyConfig `yaml:"signing_keys"`
+	SigningKID  string             `yaml:"signing_kid"`
+	// срок access-токена, клиент продлевает его refresh-токеном
+	TokenTTL   time.Duration `yaml:"token_ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+	// bcrypt или argon2id, старые хеши и пароли открытым текстом перехешируются при входе
+	PasswordHash string `yaml:"password_hash"`
+	BcryptCost   int    `yaml:"bcrypt_cost"`
+	// кроме токена требовать куку сессии того же пользователя
+	RequireSession bool `yaml:"require_session"`
+	// логины, которым при старте выдается роль admin, если такие пользователи уже есть
+	Admins []string `yaml:"admins"`
+}
+
+// SigningKeyConfig - ключ подписи токенов в PEM-файлах
+type SigningKeyConfig struct {
+	KID string `yaml:"kid"`
+	// RS256 или EdDSA
+	Alg string `yaml:"alg"`
+	// без закрытого ключа ключ годится только для проверки
+	PrivateKey string `yaml:"private_key"`
+	PublicKey  string `yaml:"public_key"`
+}
+
+type SessionConfig struct {
+	// абсолютный срок жизни сессии и куки
+	CookieTTL time.Duration `yaml:"cookie_ttl"`
+	// если больше 0, сессия истекает после такого простоя, а каждое обращение ее продлевает
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// как часто удалять истекшие сессии
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+// RateLimitConfig - защита /api/login и /api/register от перебора
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ведро попыток на IP: ip_burst сразу, дальше одна каждые ip_interval
+	IPBurst    int           `yaml:"ip_burst"`
+	IPInterval time.Duration `yaml:"ip_interval"`
+	// то же на логин, с любых адресов
+	AccountBurst    int           `yaml:"account_burst"`
+	AccountInterval time.Duration `yaml:"account_interval"`
+	// после lockout_threshold неверных паролей подряд аккаунт блокируется на lockout_base,
+	// каждая следующая неудача удваивает срок до lockout_max; неудачи старше lockout_window забываются
+	LockoutThreshold int           `yaml:"lockout_threshold"`
+	LockoutBase      time.Duration `yaml:"lockout_base"`
+	LockoutMax       time.Duration `yaml:"lockout_max"`
+	LockoutWindow    time.Duration `yaml:"lockout_window"`
+	// сервер за прокси: адрес клиента берется из X-Forwarded-For
+	TrustForwarded bool `yaml:"trust_forwarded"`
+}
+
+type PostsConfig struct {
+	// сколько после публикации автор может менять заголовок, текст можно править всегда
+	TitleEditWindow time.Duration `yaml:"title_edit_window"`
+	// сколько удаленные посты и комментарии можно восстановить, потом их удаляет очистка
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// Default - значения, которые не зависят от окружения.
+// DSN, адрес монги и секрет токена умолчаний не имеют и должны быть заданы явно
+func Default() *Config {
+	return &Config{
+		HTTP: HTTPConfig{
+			Addr:            ":8080",
+			StaticDir:       "static",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+			HealthTimeout:   2 * time.Second,
+		},
+		Storage: StorageConfig{
+			Posts:    BackendMongo,
+			Users:    BackendMySQL,
+			Sessions: BackendMySQL,
+			PostIDs:  PostIDCounter,
+		},
+		MySQL: MySQLConfig{
+			MaxOpenConns: 10,
+		},
+		Mongo: MongoConfig{
+			Collection:          "posts",
+			CountersCollection:  "counters",
+			RevisionsCollection: "post_revisions",
+		},
+		Auth: AuthConfig{
+			TokenTTL:     15 * time.Minute,
+			RefreshTTL:   30 * 24 * time.Hour,
+			PasswordHash: "bcrypt",
+			BcryptCost:   12,
+		},
+		Session: SessionConfig{
+			CookieTTL:       90 * 24 * time.Hour,
+			CleanupInterval: 10 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:          true,
+			IPBurst:          20,
+			IPInterval:       3 * time.Second,
+			AccountBurst:     10,
+			AccountInterval:  30 * time.Second,
+			LockoutThreshold: 5,
+			LockoutBase:      time.Minute,
+			LockoutMax:       time.Hour,
+			LockoutWindow:    15 * time.Minute,
+		},
+		Posts: PostsConfig{
+			TitleEditWindow: 5 * time.Minute,
+			Retention:       30 * 24 * time.Hour,
+			PurgeInterval:   time.Hour,
+		},
+	}
+}
+
+// Load собирает конфиг по приоритету: умолчания < файл < окружение < флаги.
+// Путь к файлу берется из флага -config или переменной REDDITCLONE_CONFIG
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("redditclone", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to YAML config file")
+	addr := fs.String("addr", "", "HTTP listen address")
+	mysqlDSN := fs.String("mysql-dsn", "", "MySQL DSN")
+	mongoURI := fs.String("mongo-uri", "", "MongoDB connection URI")
+	mongoDB := fs.String("mongo-db", "", "MongoDB database name")
+	tokenSecret := fs.String("token-secret", "", "JWT signing secret")
+	standalone := fs.Bool("standalone", false, "keep posts, users and sessions in memory, no databases needed")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.HTTP.Addr = *addr
+		case "mysql-dsn":
+			cfg.MySQL.DSN = *mysqlDSN
+		case "mongo-uri":
+			cfg.Mongo.URI = *mongoURI
+		case "mongo-db":
+			cfg.Mongo.Database = *mongoDB
+		case "token-secret":
+			cfg.Auth.TokenSecret = *tokenSecret
+		case "standalone":
+			if *standalone {
+				cfg.Storage.Posts = BackendMemory
+				cfg.Storage.Users = BackendMemory
+				cfg.Storage.Sessions = BackendMemory
+			}
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read %s: %w", path, err)
+	}
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv(lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"HTTP_ADDR":        &cfg.HTTP.Addr,
+		"STATIC_DIR":       &cfg.HTTP.StaticDir,
+		"STORAGE_POSTS":    &cfg.Storage.Posts,
+		"STORAGE_USERS":    &cfg.Storage.Users,
+		"STORAGE_SESSIONS": &cfg.Storage.Sessions,
+		"STORAGE_POST_IDS": &cfg.Storage.PostIDs,
+		"SNAPSHOT_DIR":     &cfg.Storage.SnapshotDir,
+		"MYSQL_DSN":        &cfg.MySQL.DSN,
+		"MONGO_URI":        &cfg.Mongo.URI,
+		"MONGO_DATABASE":   &cfg.Mongo.Database,
+		"MONGO_COLLECTION": &cfg.Mongo.Collection,
+		"MONGO_COUNTERS":   &cfg.Mongo.CountersCollection,
+		"MONGO_REVISIONS":  &cfg.Mongo.RevisionsCollection,
+		"TOKEN_SECRET":     &cfg.Auth.TokenSecret,
+		"SIGNING_KID":      &cfg.Auth.SigningKID,
+		"PASSWORD_HASH":    &cfg.Auth.PasswordHash,
+	}
+	for name, dst := range strs {
+		if v, ok := lookup(envPrefix + name); ok {
+			*dst = v
+		}
+	}
+
+	// списки через запятую
+	if v, ok := lookup(envPrefix + "ADMINS"); ok {
+		cfg.Auth.Admins = nil
+		for _, login := range strings.Split(v, ",") {
+			if login = strings.TrimSpace(login); login != "" {
+				cfg.Auth.Admins = append(cfg.Auth.Admins, login)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"MYSQL_MAX_OPEN_CONNS": &cfg.MySQL.MaxOpenConns,
+		"BCRYPT_COST":          &cfg.Auth.BcryptCost,
+	}
+	for name, dst := range ints {
+		v, ok := lookup(envPrefix + name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: %s%s: %w", envPrefix, name, err)
+		}
+		*dst = n
+	}
+
+	bools := map[string]*bool{
+		"AUTH_REQUIRE_SESSION": &cfg.Auth.RequireSession,
+		"RATE_LIMIT_ENABLED":   &cfg.RateLimit.Enabled,
+		"TRUST_FORWARDED":      &cfg.RateLimit.TrustForwarded,
+	}
+	for name, dst := range bools {
+		v, ok := lookup(envPrefix + name)
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: %s%s: %w", envPrefix, name, err)
+		}
+		*dst = b
+	}
+
+	durations := map[string]*time.Duration{
+		"HTTP_READ_TIMEOUT":     &cfg.HTTP.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":    &cfg.HTTP.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":     &cfg.HTTP.IdleTimeout,
+		"HTTP_SHUTDOWN_TIMEOUT": &cfg.HTTP.ShutdownTimeout,
+		"HTTP_HEALTH_TIMEOUT":   &cfg.HTTP.HealthTimeout,
+		"TOKEN_TTL":             &cfg.Auth.TokenTTL,
+		"REFRESH_TTL":           &cfg.Auth.RefreshTTL,
+		"COOKIE_TTL":            &cfg.Session.CookieTTL,
+		"SESSION_IDLE_TIMEOUT":  &cfg.Session.IdleTimeout,
+		"SESSION_CLEANUP":       &cfg.Session.CleanupInterval,
+		"TITLE_EDIT_WINDOW":     &cfg.Posts.TitleEditWindow,
+		"POST_RETENTION":        &cfg.Posts.Retention,
+		"POST_PURGE_INTERVAL":   &cfg.Posts.PurgeInterval,
+	}
+	for name, dst := range durations {
+		v, ok := lookup(envPrefix + name)
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("config: %s%s: %w", envPrefix, name, err)
+		}
+		*dst = d
+	}
+	return nil
+}
+
+func (a AuthConfig) validateKeys() []string {
+	if len(a.SigningKeys) == 0 {
+		if a.TokenSecret == "" {
+			return []string{"auth.token_secret or auth.signing_keys is required"}
+		}
+		if a.SigningKID != "" {
+			return []string{fmt.Sprintf("auth.signing_kid: unknown key %q", a.SigningKID)}
+		}
+		return nil
+	}
+
+	var problems []string
+	seen := map[string]bool{}
+	canSign := false
+	for i, k := range a.SigningKeys {
+		switch {
+		case k.KID == "":
+			problems = append(problems, fmt.Sprintf("auth.signing_keys[%d].kid is required", i))
+		case seen[k.KID]:
+			problems = append(problems, fmt.Sprintf("auth.signing_keys: duplicate kid %q", k.KID))
+		}
+		seen[k.KID] = true
+		if k.Alg != jwtkeys.AlgRS256 && k.Alg != jwtkeys.AlgEdDSA {
+			problems = append(problems, fmt.Sprintf("auth.signing_keys[%d].alg: unknown %q", i, k.Alg))
+		}
+		if k.PrivateKey == "" && k.PublicKey == "" {
+			problems = append(problems, fmt.Sprintf("auth.signing_keys[%d]: private_key or public_key is required", i))
+		}
+		if k.PrivateKey != "" && (a.SigningKID == "" || a.SigningKID == k.KID) {
+			canSign = true
+		}
+	}
+	if !canSign {
+		problems = append(problems, fmt.Sprintf("auth.signing_kid: no private key for %q", a.SigningKID))
+	}
+	return problems
+}
+
+// Validate проверяет конфиг целиком и возвращает все найденные проблемы одной ошибкой
+func (cfg *Config) Validate() error {
+	var problems []string
+	if cfg.HTTP.Addr == "" {
+		problems = append(problems, "http.addr is required")
+	}
+	if cfg.HTTP.ReadTimeout <= 0 || cfg.HTTP.WriteTimeout <= 0 || cfg.HTTP.IdleTimeout <= 0 {
+		problems = append(problems, "http read/write/idle timeouts must be positive")
+	}
+	if cfg.HTTP.ShutdownTimeout <= 0 {
+		problems = append(problems, "http.shutdown_timeout must be positive")
+	}
+	if cfg.HTTP.HealthTimeout <= 0 {
+		problems = append(problems, "http.health_timeout must be positive")
+	}
+	if cfg.Storage.Users != BackendMySQL && cfg.Storage.Users != BackendMemory {
+		problems = append(problems, fmt.Sprintf("storage.users: unknown backend %q", cfg.Storage.Users))
+	}
+	if cfg.Storage.Sessions != BackendMySQL && cfg.Storage.Sessions != BackendMemory {
+		problems = append(problems, fmt.Sprintf("storage.sessions: unknown backend %q", cfg.Storage.Sessions))
+	}
+	if cfg.Storage.NeedsMySQL() {
+		if cfg.MySQL.DSN == "" {
+			problems = append(problems, "mysql.dsn is required")
+		}
+		if cfg.MySQL.MaxOpenConns <= 0 {
+			problems = append(problems, "mysql.max_open_conns must be positive")
+		}
+	}
+	switch cfg.Storage.Posts {
+	case BackendMongo:
+		if cfg.Mongo.URI == "" {
+			problems = append(problems, "mongo.uri is required")
+		}
+		if cfg.Mongo.Database == "" {
+			problems = append(problems, "mongo.database is required")
+		}
+		if cfg.Mongo.Collection == "" {
+			problems = append(problems, "mongo.collection is required")
+		}
+		if cfg.Storage.PostIDs == PostIDCounter && cfg.Mongo.CountersCollection == "" {
+			problems = append(problems, "mongo.counters_collection is required")
+		}
+		if cfg.Mongo.RevisionsCollection == "" {
+			problems = append(problems, "mongo.revisions_collection is required")
+		}
+	case BackendMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("storage.posts: unknown backend %q", cfg.Storage.Posts))
+	}
+	if cfg.Storage.PostIDs != PostIDCounter && cfg.Storage.PostIDs != PostIDULID {
+		problems = append(problems, fmt.Sprintf("storage.post_ids: unknown generator %q", cfg.Storage.PostIDs))
+	}
+	problems = append(problems, cfg.Auth.validateKeys()...)
+	if cfg.Auth.TokenTTL <= 0 {
+		problems = append(problems, "auth.token_ttl must be positive")
+	}
+	if cfg.Auth.RefreshTTL <= cfg.Auth.TokenTTL {
+		problems = append(problems, "auth.refresh_ttl must be longer than auth.token_ttl")
+	}
+	if _, err := password.New(cfg.Auth.PasswordHash, cfg.Auth.BcryptCost); err != nil {
+		problems = append(problems, "auth.password_hash: "+err.Error())
+	}
+	if cfg.Session.CookieTTL <= 0 {
+		problems = append(problems, "session.cookie_ttl must be positive")
+	}
+	if rl := cfg.RateLimit; rl.Enabled {
+		if rl.IPBurst <= 0 || rl.AccountBurst <= 0 || rl.IPInterval <= 0 || rl.AccountInterval <= 0 {
+			problems = append(problems, "rate_limit bursts and intervals must be positive")
+		}
+		if rl.LockoutThreshold <= 0 || rl.LockoutBase <= 0 || rl.LockoutWindow <= 0 {
+			problems = append(problems, "rate_limit lockout threshold, base and window must be positive")
+		}
+		if rl.LockoutMax < rl.LockoutBase {
+			problems = append(problems, "rate_limit.lockout_max must not be shorter than rate_limit.lockout_base")
+		}
+	}
+	if cfg.Posts.TitleEditWindow < 0 {
+		problems = append(problems, "posts.title_edit_window must not be negative")
+	}
+	if cfg.Posts.Retention <= 0 || cfg.Posts.PurgeInterval <= 0 {
+		problems = append(problems, "posts.retention and posts.purge_interval must be positive")
+	}
+	if cfg.Session.IdleTimeout < 0 {
+		problems = append(problems, "session.idle_timeout must not be negative")
+	}
+	if cfg.Session.CleanupInterval <= 0 {
+		problems = append(problems, "session.cleanup_interval must be positive")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("config: invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("cant write config: %s", err)
+	}
+	return path
+}
+
+const fullConfig = `
+http:
+  addr: ":9090"
+mysql:
+  dsn: "root:pass@tcp(db:3306)/golang"
+mongo:
+  uri: "mongodb://mongo:27017"
+  database: "reddit"
+auth:
+  token_secret: "file_secret"
+  token_ttl: 1h
+`
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, fullConfig)
+
+	cfg, err := Load([]string{"-config", path})
+	assert.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.HTTP.Addr)
+	assert.Equal(t, "root:pass@tcp(db:3306)/golang", cfg.MySQL.DSN)
+	assert.Equal(t, "reddit", cfg.Mongo.Database)
+	assert.Equal(t, time.Hour, cfg.Auth.TokenTTL)
+
+	// не заданные в файле поля остаются по умолчанию
+	assert.Equal(t, "posts", cfg.Mongo.Collection)
+	assert.Equal(t, 10, cfg.MySQL.MaxOpenConns)
+	assert.Equal(t, "post_revisions", cfg.Mongo.RevisionsCollection)
+	assert.Equal(t, 5*time.Minute, cfg.Posts.TitleEditWindow)
+	assert.Equal(t, 720*time.Hour, cfg.Posts.Retention)
+	assert.Equal(t, time.Hour, cfg.Posts.PurgeInterval)
+}
+
+func TestEnvAndFlagsOverride(t *testing.T) {
+	path := writeConfig(t, fullConfig)
+	os.Setenv("REDDITCLONE_HTTP_ADDR", ":7070")
+	os.Setenv("REDDITCLONE_TOKEN_SECRET", "env_secret")
+	os.Setenv("REDDITCLONE_TOKEN_TTL", "30m")
+	os.Setenv("REDDITCLONE_AUTH_REQUIRE_SESSION", "true")
+	os.Setenv("REDDITCLONE_ADMINS", "ayta, qwe")
+	defer os.Unsetenv("REDDITCLONE_ADMINS")
+	defer os.Unsetenv("REDDITCLONE_HTTP_ADDR")
+	defer os.Unsetenv("REDDITCLONE_TOKEN_SECRET")
+	defer os.Unsetenv("REDDITCLONE_TOKEN_TTL")
+	defer os.Unsetenv("REDDITCLONE_AUTH_REQUIRE_SESSION")
+
+	cfg, err := Load([]string{"-config", path, "-token-secret", "flag_secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, ":7070", cfg.HTTP.Addr)
+	assert.Equal(t, "flag_secret", cfg.Auth.TokenSecret)
+	assert.Equal(t, 30*time.Minute, cfg.Auth.TokenTTL)
+	assert.True(t, cfg.Auth.RequireSession)
+	assert.Equal(t, []string{"ayta", "qwe"}, cfg.Auth.Admins)
+}
+
+func TestSigningKeys(t *testing.T) {
+	// с асимметричными ключами общий секрет не обязателен
+	cfg, err := Load([]string{"-config", writeConfig(t, `
+mysql:
+  dsn: "root:pass@tcp(db:3306)/golang"
+mongo:
+  uri: "mongodb://mongo:27017"
+  database: "reddit"
+auth:
+  signing_keys:
+    - kid: "2022-06"
+      alg: EdDSA
+      private_key: "/keys/2022-06.pem"
+    - kid: "2022-01"
+      alg: RS256
+      public_key: "/keys/2022-01.pub.pem"
+`)})
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Auth.SigningKeys, 2)
+	assert.Equal(t, "/keys/2022-01.pub.pem", cfg.Auth.SigningKeys[1].PublicKey)
+}
+
+func TestMemoryPostsNoMongo(t *testing.T) {
+	cfg, err := Load([]string{"-config", writeConfig(t, `
+storage:
+  posts: memory
+mysql:
+  dsn: "root:pass@tcp(db:3306)/golang"
+auth:
+  token_secret: "file_secret"
+`)})
+	assert.NoError(t, err)
+	assert.Equal(t, BackendMemory, cfg.Storage.Posts)
+}
+
+func TestStandalone(t *testing.T) {
+	cfg, err := Load([]string{"-standalone", "-token-secret", "secret"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Storage.Standalone())
+	assert.False(t, cfg.Storage.NeedsMySQL())
+}
+
+func TestBadConfig(t *testing.T) {
+	_, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+
+	_, err = Load([]string{"-config", writeConfig(t, "http: [")})
+	assert.Error(t, err)
+
+	// обязательные поля не заданы - все проблемы в одной ошибке
+	_, err = Load(nil)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "mysql.dsn"))
+	assert.True(t, strings.Contains(err.Error(), "auth.token_secret"))
+
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"storage:\n  posts: redis\n")})
+	assert.Error(t, err)
+
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"storage:\n  post_ids: uuid\n")})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "storage.post_ids"))
+
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+`  signing_kid: "b"
+  signing_keys:
+    - kid: "a"
+      alg: HS512
+      private_key: "a.pem"
+    - kid: "b"
+      alg: RS256
+      public_key: "b.pub"
+`)})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "auth.signing_keys[0].alg"))
+	assert.True(t, strings.Contains(err.Error(), `no private key for "b"`))
+
+	// refresh-токен не может жить меньше access-токена
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"  refresh_ttl: 30m\n")})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "auth.refresh_ttl"))
+
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"rate_limit:\n  lockout_max: 10s\n")})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "rate_limit.lockout_max"))
+	// выключенный ограничитель не проверяется
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"rate_limit:\n  enabled: false\n  ip_burst: 0\n")})
+	assert.NoError(t, err)
+
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"posts:\n  title_edit_window: -1m\n")})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "posts.title_edit_window"))
+
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig+"posts:\n  retention: 0s\n")})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "posts.retention"))
+
+	os.Setenv("REDDITCLONE_COOKIE_TTL", "forever")
+	defer os.Unsetenv("REDDITCLONE_COOKIE_TTL")
+	_, err = Load([]string{"-config", writeConfig(t, fullConfig)})
+	assert.Error(t, err)
+}
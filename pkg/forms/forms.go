@@ -15,6 +15,16 @@ type LoginForm struct {
 	Password string `json:"password"`
 }
 
+type RefreshForm struct {
+	Token string `json:"refresh_token"`
+}
+
+// RoleForm - смена роли в админке, категории нужны только модератору
+type RoleForm struct {
+	Role       string   `json:"role"`
+	Categories []string `json:"categories"`
+}
+
 type UserForm struct {
 	ID    string `json:"id"`
 	Login string `json:"username"`
@@ -29,6 +39,18 @@ type CommentForm struct {
 	Description string `json:"comment"`
 }
 
+// PostEditForm - правка поста. В PATCH отсутствующие поля не меняются
+type PostEditForm struct {
+	Title *string `json:"title"`
+	Text  *string `json:"text"`
+	Url   *string `json:"url"`
+}
+
+// DeleteForm - необязательное тело DELETE поста или комментария
+type DeleteForm struct {
+	Reason string `json:"reason"`
+}
+
 type PostFirstData struct {
 	Url        string `json:"url"`
 	Category   string `json:"category"`
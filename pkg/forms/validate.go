@@ -0,0 +1,205 @@
+package forms
+
+import (
+	"fmt"
+	"net/url"
+	"redditclone/pkg/errorsForProject"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// правила совпадают с проверками фронтенда. Сообщения называют границы включительно
+// ("at least", "at most"), как их и проверяют
+
+const (
+	UsernameMaxLen = 32
+	PasswordMinLen = 8
+	// bcrypt учитывает только первые 72 байта
+	PasswordMaxLen = 72
+	TitleMaxLen    = 100
+	TextMinLen     = 4
+	ReasonMaxLen   = 200
+
+	PostTypeLink = "link"
+	PostTypeText = "text"
+)
+
+var (
+	usernameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+	// имена, которые путаются с маршрутами или служебными записями
+	ReservedUsernames = map[string]bool{
+		"admin": true, "administrator": true, "root": true, "system": true,
+		"moderator": true, "api": true, "static": true, "deleted": true,
+		"null": true, "undefined": true, "me": true,
+	}
+
+	Categories = map[string]bool{
+		"music": true, "funny": true, "videos": true,
+		"programming": true, "news": true, "fashion": true,
+	}
+
+	commonPasswords = map[string]bool{
+		"password": true, "password1": true, "qwertyui": true, "qwerty123": true,
+		"iloveyou": true, "sunshine": true, "football": true, "baseball": true,
+		"abc12345": true, "abcd1234": true, "passw0rd": true, "letmein1": true,
+	}
+)
+
+// Validate возвращает все ошибки формы регистрации сразу, nil - форма корректна
+func (f *LoginForm) Validate() []errorsForProject.RegisterError {
+	v := &validator{}
+
+	switch {
+	case f.Login == "":
+		v.add("username", f.Login, "required")
+	case utf8.RuneCountInString(f.Login) > UsernameMaxLen:
+		v.add("username", f.Login, fmt.Sprintf("must be at most %d characters", UsernameMaxLen))
+	case !usernameRe.MatchString(f.Login):
+		v.add("username", f.Login, "contains invalid characters")
+	case ReservedUsernames[strings.ToLower(f.Login)]:
+		v.add("username", f.Login, "is reserved")
+	}
+
+	// значение пароля в ответ не отдаем
+	switch {
+	case f.Password == "":
+		v.add("password", "", "required")
+	case utf8.RuneCountInString(f.Password) < PasswordMinLen:
+		v.add("password", "", fmt.Sprintf("must be at least %d characters", PasswordMinLen))
+	case len(f.Password) > PasswordMaxLen:
+		v.add("password", "", fmt.Sprintf("must be at most %d bytes", PasswordMaxLen))
+	case strings.TrimSpace(f.Password) != f.Password:
+		v.add("password", "", "cannot start or end with whitespace")
+	case f.Login != "" && strings.Contains(strings.ToLower(f.Password), strings.ToLower(f.Login)):
+		v.add("password", "", "must not contain username")
+	case commonPasswords[strings.ToLower(f.Password)] || charClasses(f.Password) < 2:
+		v.add("password", "", "is too weak, mix letters, digits or symbols")
+	}
+
+	return v.errs
+}
+
+// Validate проверяет данные нового поста
+func (f *PostFirstData) Validate() []errorsForProject.RegisterError {
+	v := &validator{}
+
+	if !Categories[f.Category] {
+		v.add("category", f.Category, "unknown category")
+	}
+
+	title := strings.TrimSpace(f.Title)
+	switch {
+	case title == "":
+		v.add("title", f.Title, "required")
+	case utf8.RuneCountInString(f.Title) > TitleMaxLen:
+		v.add("title", f.Title, fmt.Sprintf("must be at most %d characters", TitleMaxLen))
+	}
+
+	switch f.TypeOfPost {
+	case PostTypeLink:
+		if f.Url == "" {
+			v.add("url", f.Url, "required")
+		} else if !validURL(f.Url) {
+			v.add("url", f.Url, "must be a valid url")
+		}
+	case PostTypeText:
+		if utf8.RuneCountInString(strings.TrimSpace(f.Text)) < TextMinLen {
+			v.add("text", f.Text, fmt.Sprintf("must be at least %d characters", TextMinLen))
+		}
+	case "":
+		v.add("type", f.TypeOfPost, "required")
+	default:
+		v.add("type", f.TypeOfPost, "must be link or text post")
+	}
+
+	return v.errs
+}
+
+// Validate проверяет правку поста типа postType. Для PUT (partial == false) тело поста
+// обязательно, для PATCH нужно хотя бы одно поле. Менять можно только тело своего типа
+func (f *PostEditForm) Validate(postType string, partial bool) []errorsForProject.RegisterError {
+	v := &validator{}
+
+	if f.Title != nil {
+		title := strings.TrimSpace(*f.Title)
+		switch {
+		case title == "":
+			v.add("title", *f.Title, "required")
+		case utf8.RuneCountInString(*f.Title) > TitleMaxLen:
+			v.add("title", *f.Title, fmt.Sprintf("must be at most %d characters", TitleMaxLen))
+		}
+	}
+
+	body, bodyName, other, otherName := f.Text, "text", f.Url, "url"
+	if postType == PostTypeLink {
+		body, bodyName, other, otherName = f.Url, "url", f.Text, "text"
+	}
+	if other != nil {
+		v.add(otherName, *other, fmt.Sprintf("cannot be set on a %s post", postType))
+	}
+	switch {
+	case body == nil && !partial:
+		v.add(bodyName, "", "required")
+	case body == nil:
+		if f.Title == nil && other == nil {
+			v.add(bodyName, "", "nothing to change")
+		}
+	case postType == PostTypeLink && !validURL(*body):
+		v.add(bodyName, *body, "must be a valid url")
+	case postType == PostTypeText && utf8.RuneCountInString(strings.TrimSpace(*body)) < TextMinLen:
+		v.add(bodyName, *body, fmt.Sprintf("must be at least %d characters", TextMinLen))
+	}
+
+	return v.errs
+}
+
+func (f *DeleteForm) Validate() []errorsForProject.RegisterError {
+	v := &validator{}
+	if utf8.RuneCountInString(f.Reason) > ReasonMaxLen {
+		v.add("reason", f.Reason, fmt.Sprintf("must be at most %d characters", ReasonMaxLen))
+	}
+	return v.errs
+}
+
+type validator struct {
+	errs []errorsForProject.RegisterError
+}
+
+func (v *validator) add(param, value, msg string) {
+	v.errs = append(v.errs, errorsForProject.RegisterError{
+		Location: "body",
+		Param:    param,
+		Value:    value,
+		Msg:      msg,
+	})
+}
+
+// validURL - только абсолютные http(s) ссылки, чтобы не пропустить javascript: и подобное
+func validURL(raw string) bool {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// charClasses считает, сколько видов символов есть в пароле: строчные, заглавные, цифры, прочие
+func charClasses(pass string) int {
+	var lower, upper, digit, other int
+	for _, r := range pass {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
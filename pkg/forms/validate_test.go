@@ -0,0 +1,116 @@
+package forms
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginFormValidate(t *testing.T) {
+	cases := []struct {
+		form   LoginForm
+		params []string
+	}{
+		{LoginForm{Login: "ayta", Password: "qwe12345"}, nil},
+		{LoginForm{Login: "ay_ta-1", Password: "Correct Horse"}, nil},
+		{LoginForm{}, []string{"username", "password"}},
+		{LoginForm{Login: "ay ta", Password: "qwe1234"}, []string{"username", "password"}},
+		{LoginForm{Login: strings.Repeat("a", 33), Password: "qwe12345"}, []string{"username"}},
+		{LoginForm{Login: "Admin", Password: "qwe12345"}, []string{"username"}},
+		{LoginForm{Login: "ayta", Password: "12345678"}, []string{"password"}},
+		{LoginForm{Login: "ayta", Password: "Password1"}, []string{"password"}},
+		{LoginForm{Login: "ayta", Password: "ayta2022!"}, []string{"password"}},
+		{LoginForm{Login: "ayta", Password: " qwe12345"}, []string{"password"}},
+		{LoginForm{Login: "ayta", Password: strings.Repeat("a1", 37)}, []string{"password"}},
+		// предел в байтах: 50 символов, но 75 байт
+		{LoginForm{Login: "ayta", Password: strings.Repeat("я1", 25)}, []string{"password"}},
+	}
+	for _, c := range cases {
+		errs := c.form.Validate()
+		got := []string{}
+		for _, e := range errs {
+			assert.Equal(t, "body", e.Location)
+			if e.Param == "password" {
+				assert.Empty(t, e.Value, "password must not be echoed")
+			}
+			got = append(got, e.Param)
+		}
+		if c.params == nil {
+			assert.Empty(t, errs, "%+v", c.form)
+			continue
+		}
+		assert.Equal(t, c.params, got, "%+v", c.form)
+	}
+}
+
+func TestPostFirstDataValidate(t *testing.T) {
+	cases := []struct {
+		form   PostFirstData
+		params []string
+	}{
+		{PostFirstData{Category: "music", Title: "qwe", TypeOfPost: "link", Url: "https://example.com/a?b=c"}, nil},
+		{PostFirstData{Category: "news", Title: "qwe", TypeOfPost: "text", Text: "some text"}, nil},
+		{PostFirstData{}, []string{"category", "title", "type"}},
+		{PostFirstData{Category: "cats", Title: "   ", TypeOfPost: "link", Url: "privet"}, []string{"category", "title", "url"}},
+		{PostFirstData{Category: "music", Title: "qwe", TypeOfPost: "link", Url: "javascript:alert(1)"}, []string{"url"}},
+		{PostFirstData{Category: "music", Title: "qwe", TypeOfPost: "link"}, []string{"url"}},
+		{PostFirstData{Category: "music", Title: strings.Repeat("й", 101), TypeOfPost: "text", Text: "abc"}, []string{"title", "text"}},
+		{PostFirstData{Category: "music", Title: "qwe", TypeOfPost: "url", Url: "https://example.com"}, []string{"type"}},
+	}
+	for _, c := range cases {
+		errs := c.form.Validate()
+		got := []string{}
+		for _, e := range errs {
+			got = append(got, e.Param)
+		}
+		if c.params == nil {
+			assert.Empty(t, errs, "%+v", c.form)
+			continue
+		}
+		assert.Equal(t, c.params, got, "%+v", c.form)
+	}
+}
+
+func TestPostEditFormValidate(t *testing.T) {
+	s := func(v string) *string { return &v }
+	cases := []struct {
+		form     PostEditForm
+		postType string
+		partial  bool
+		params   []string
+	}{
+		{PostEditForm{Text: s("new text")}, "text", false, nil},
+		{PostEditForm{Title: s("qwe"), Text: s("new text")}, "text", false, nil},
+		{PostEditForm{Url: s("https://example.com")}, "link", false, nil},
+		{PostEditForm{Title: s("qwe")}, "text", true, nil},
+		{PostEditForm{Title: s("qwe")}, "text", false, []string{"text"}},
+		{PostEditForm{}, "link", true, []string{"url"}},
+		{PostEditForm{Text: s("abc")}, "text", true, []string{"text"}},
+		{PostEditForm{Url: s("javascript:alert(1)")}, "link", true, []string{"url"}},
+		{PostEditForm{Title: s(" "), Url: s("https://example.com")}, "text", true, []string{"title", "url"}},
+		{PostEditForm{Text: s("new text")}, "link", false, []string{"text", "url"}},
+	}
+	for _, c := range cases {
+		errs := c.form.Validate(c.postType, c.partial)
+		got := []string{}
+		for _, e := range errs {
+			got = append(got, e.Param)
+		}
+		if c.params == nil {
+			assert.Empty(t, errs, "%+v", c.form)
+			continue
+		}
+		assert.Equal(t, c.params, got, "%+v", c.form)
+	}
+}
+
+func TestDeleteFormValidate(t *testing.T) {
+	assert.Empty(t, (&DeleteForm{}).Validate())
+	assert.Empty(t, (&DeleteForm{Reason: strings.Repeat("я", ReasonMaxLen)}).Validate())
+
+	errs := (&DeleteForm{Reason: strings.Repeat("я", ReasonMaxLen+1)}).Validate()
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "reason", errs[0].Param)
+	}
+}
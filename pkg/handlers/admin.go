@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/errorsForProject"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"strconv"
+	"time"
+)
+
+var ErrOwnAccount = errors.New(" cant change own account")
+
+// AdminHandler - /api/admin/*, доступ только админам проверяет middleware до вызова
+type AdminHandler struct {
+	Logger         *zap.SugaredLogger
+	UserRepo       user.UsersRepo
+	SessionManager session.SessionRepo
+	RefreshTokens  session.RefreshRepo
+}
+
+// adminUser - пользователь в ответах админки, без хеша пароля
+type adminUser struct {
+	ID         uint32   `json:"id"`
+	Login      string   `json:"username"`
+	Role       string   `json:"role"`
+	Categories []string `json:"categories"`
+	Disabled   bool     `json:"disabled"`
+}
+
+func newAdminUser(u *user.User) adminUser {
+	categories := u.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	return adminUser{
+		ID:         u.ID,
+		Login:      u.Login,
+		Role:       u.Role,
+		Categories: categories,
+		Disabled:   u.Disabled,
+	}
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.UserRepo.List()
+	if err != nil {
+		h.Logger.Errorw("can't list users", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't list users", h.Logger)
+		return
+	}
+
+	res := make([]adminUser, 0, len(users))
+	for _, u := range users {
+		res = append(res, newAdminUser(u))
+	}
+	h.send(w, res)
+}
+
+// SetRole меняет роль и категории модератора. Выданные токены со старой ролью отзываются,
+// новые клиент получит через refresh без повторного входа
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	fd := &forms.RoleForm{}
+	if err := json.NewDecoder(r.Body).Decode(&fd); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, "bad request", h.Logger)
+		return
+	}
+	if errs := validateRole(fd); len(errs) > 0 {
+		SendValidationErrors(w, errs, h.Logger)
+		return
+	}
+
+	u, err := h.UserRepo.SetRole(id, fd.Role, fd.Categories)
+	if err == nil {
+		err = h.SessionManager.RevokeTokens(id, time.Now())
+	}
+	if !h.updated(w, err, "SetRole: ") {
+		return
+	}
+	h.Logger.Infow("role changed", "user", id, "role", fd.Role, "categories", fd.Categories)
+	h.send(w, newAdminUser(u))
+}
+
+// Disable блокирует вход и сразу завершает все сессии пользователя
+func (h *AdminHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.UserRepo.SetDisabled(id, true)
+	if err == nil {
+		_, err = h.logoutEverywhere(id)
+	}
+	if !h.updated(w, err, "Disable: ") {
+		return
+	}
+	h.Logger.Infow("user disabled", "user", id)
+	h.send(w, newAdminUser(u))
+}
+
+func (h *AdminHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.UserRepo.SetDisabled(id, false)
+	if !h.updated(w, err, "Enable: ") {
+		return
+	}
+	h.Logger.Infow("user enabled", "user", id)
+	h.send(w, newAdminUser(u))
+}
+
+// Logout - принудительный выход пользователя на всех устройствах
+func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	id, err := userID(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, "Logout: "+err.Error(), h.Logger)
+		return
+	}
+	_, err = h.UserRepo.GetByID(id)
+	if !h.updated(w, err, "Logout: ") {
+		return
+	}
+
+	n, err := h.logoutEverywhere(id)
+	if !h.updated(w, err, "Logout: ") {
+		return
+	}
+	h.Logger.Infow("user logged out by admin", "user", id, "sessions", n)
+	h.send(w, map[string]interface{}{
+		"message":  "logged out everywhere",
+		"sessions": n,
+	})
+}
+
+func (h *AdminHandler) logoutEverywhere(id uint32) (int64, error) {
+	n, err := h.SessionManager.DestroyByUser(id)
+	if err != nil {
+		return 0, err
+	}
+	if err = h.RefreshTokens.RevokeRefreshByUser(id); err != nil {
+		return 0, err
+	}
+	return n, h.SessionManager.RevokeTokens(id, time.Now())
+}
+
+// target - id пользователя из пути. Свою роль и блокировку админ не меняет,
+// иначе можно остаться без единого админа
+func (h *AdminHandler) target(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	id, err := userID(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, "Admin: "+err.Error(), h.Logger)
+		return 0, false
+	}
+	p, err := session.PrincipalFromContext(r.Context())
+	if err == nil && p.UserID == id {
+		err = ErrOwnAccount
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		JsonError(w, http.StatusForbidden, "Admin: "+err.Error(), h.Logger)
+		return 0, false
+	}
+	return id, true
+}
+
+func userID(r *http.Request) (uint32, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["USER_ID"], 10, 32)
+	if err != nil {
+		return 0, user.ErrNoUser
+	}
+	return uint32(id), nil
+}
+
+// updated отвечает ошибкой изменения и возвращает false, если она была
+func (h *AdminHandler) updated(w http.ResponseWriter, err error, errStr string) bool {
+	switch err {
+	case nil:
+		return true
+	case user.ErrNoUser:
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, errStr+err.Error(), h.Logger)
+	default:
+		h.Logger.Errorw("admin action failed", "action", errStr, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, errStr+"internal error", h.Logger)
+	}
+	return false
+}
+
+func (h *AdminHandler) send(w http.ResponseWriter, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		JsonError(w, http.StatusBadRequest, "Admin: "+errorsForProject.ErrCantMarshal.Error(), h.Logger)
+		return
+	}
+	w.Write(resp)
+}
+
+// validateRole - категории задаются только модератору, и без них модератор ничего не может
+func validateRole(fd *forms.RoleForm) []errorsForProject.RegisterError {
+	var errs []errorsForProject.RegisterError
+	add := func(param, value, msg string) {
+		errs = append(errs, errorsForProject.RegisterError{Location: "body", Param: param, Value: value, Msg: msg})
+	}
+
+	if !authz.ValidRole(fd.Role) {
+		add("role", fd.Role, "must be user, moderator or admin")
+		return errs
+	}
+	if fd.Role != authz.RoleModerator {
+		if len(fd.Categories) > 0 {
+			add("categories", "", "only for moderator")
+		}
+		return errs
+	}
+	if len(fd.Categories) == 0 {
+		add("categories", "", "required")
+	}
+	for _, c := range fd.Categories {
+		if !forms.Categories[c] {
+			add("categories", c, "unknown category")
+		}
+	}
+	return errs
+}
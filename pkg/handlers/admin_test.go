@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+// adminRequest - запрос админа с id 1 к пользователю id
+func adminRequest(method, id string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, "/api/admin/users/"+id, body)
+	req = mux.SetURLVars(req, map[string]string{"USER_ID": id})
+	return withUser(req, 1, "admin")
+}
+
+func TestAdminListUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	service := &AdminHandler{
+		Logger:   nopLogger(),
+		UserRepo: st,
+	}
+
+	st.EXPECT().List().Return([]*user.User{
+		{ID: 1, Login: "ayta", Password: "hash", Role: "admin"},
+		{ID: 2, Login: "qwe", Password: "hash", Role: "moderator", Categories: []string{"music"}, Disabled: true},
+	}, nil)
+	w := httptest.NewRecorder()
+	service.ListUsers(w, adminRequest("GET", "", nil))
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	want := `[{"id":1,"username":"ayta","role":"admin","categories":[],"disabled":false},` +
+		`{"id":2,"username":"qwe","role":"moderator","categories":["music"],"disabled":true}]`
+	if w.Code != http.StatusOK || string(body) != want {
+		t.Errorf("bad response: %d %s", w.Code, body)
+	}
+
+	st.EXPECT().List().Return(nil, fmt.Errorf("db is down"))
+	w = httptest.NewRecorder()
+	service.ListUsers(w, adminRequest("GET", "", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("bad status: %d", w.Code)
+	}
+}
+
+func TestAdminSetRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	ses := session.NewMockSessionRepo(ctrl)
+	service := &AdminHandler{
+		Logger:         nopLogger(),
+		UserRepo:       st,
+		SessionManager: ses,
+	}
+	call := func(id, body string) (int, string) {
+		w := httptest.NewRecorder()
+		service.SetRole(w, adminRequest("PUT", id, strings.NewReader(body)))
+		resp, _ := ioutil.ReadAll(w.Result().Body)
+		return w.Code, string(resp)
+	}
+
+	// старые токены со старой ролью отзываются
+	st.EXPECT().SetRole(uint32(2), "moderator", []string{"music"}).
+		Return(&user.User{ID: 2, Login: "qwe", Role: "moderator", Categories: []string{"music"}}, nil)
+	ses.EXPECT().RevokeTokens(uint32(2), gomock.Any()).Return(nil)
+	code, body := call("2", `{"role": "moderator", "categories": ["music"]}`)
+	if code != http.StatusOK || !strings.Contains(body, `"role":"moderator"`) {
+		t.Errorf("bad response: %d %s", code, body)
+	}
+
+	st.EXPECT().SetRole(uint32(9), "admin", nil).Return(nil, user.ErrNoUser)
+	code, _ = call("9", `{"role": "admin"}`)
+	if code != http.StatusNotFound {
+		t.Errorf("bad status for unknown user: %d", code)
+	}
+
+	bad := []struct {
+		id, body string
+		code     int
+	}{
+		{"2", `{"role": "root"}`, http.StatusUnprocessableEntity},
+		{"2", `{"role": "moderator"}`, http.StatusUnprocessableEntity},
+		{"2", `{"role": "moderator", "categories": ["cats"]}`, http.StatusUnprocessableEntity},
+		{"2", `{"role": "user", "categories": ["music"]}`, http.StatusUnprocessableEntity},
+		{"2", `{"role":`, http.StatusBadRequest},
+		{"abc", `{"role": "user"}`, http.StatusBadRequest},
+		// себе роль не меняем
+		{"1", `{"role": "user"}`, http.StatusForbidden},
+	}
+	for _, c := range bad {
+		code, body = call(c.id, c.body)
+		if code != c.code {
+			t.Errorf("%s %s: want %d, have %d %s", c.id, c.body, c.code, code, body)
+		}
+	}
+}
+
+func TestAdminDisable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	ses := session.NewMockSessionRepo(ctrl)
+	refresh := testRefresh(t)
+	service := &AdminHandler{
+		Logger:         nopLogger(),
+		UserRepo:       st,
+		SessionManager: ses,
+		RefreshTokens:  refresh,
+	}
+	token, _ := refresh.IssueRefresh(2, "qwe")
+
+	// блокировка сразу выкидывает пользователя отовсюду
+	st.EXPECT().SetDisabled(uint32(2), true).Return(&user.User{ID: 2, Login: "qwe", Role: "user", Disabled: true}, nil)
+	ses.EXPECT().DestroyByUser(uint32(2)).Return(int64(1), nil)
+	ses.EXPECT().RevokeTokens(uint32(2), gomock.Any()).Return(nil)
+	w := httptest.NewRecorder()
+	service.Disable(w, adminRequest("POST", "2", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if w.Code != http.StatusOK || !bytes.Contains(body, []byte(`"disabled":true`)) {
+		t.Errorf("bad response: %d %s", w.Code, body)
+	}
+	if _, _, err := refresh.RotateRefresh(token); err != session.ErrNoRefresh {
+		t.Errorf("refresh token not revoked: %v", err)
+	}
+
+	st.EXPECT().SetDisabled(uint32(2), false).Return(&user.User{ID: 2, Login: "qwe", Role: "user"}, nil)
+	w = httptest.NewRecorder()
+	service.Enable(w, adminRequest("POST", "2", nil))
+	body, _ = ioutil.ReadAll(w.Result().Body)
+	if w.Code != http.StatusOK || !bytes.Contains(body, []byte(`"disabled":false`)) {
+		t.Errorf("bad response: %d %s", w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	service.Disable(w, adminRequest("POST", "1", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("admin disabled himself: %d", w.Code)
+	}
+
+	st.EXPECT().SetDisabled(uint32(3), true).Return(nil, fmt.Errorf("db is down"))
+	w = httptest.NewRecorder()
+	service.Disable(w, adminRequest("POST", "3", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("bad status: %d", w.Code)
+	}
+}
+
+func TestAdminLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	ses := session.NewMockSessionRepo(ctrl)
+	service := &AdminHandler{
+		Logger:         nopLogger(),
+		UserRepo:       st,
+		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+	}
+
+	st.EXPECT().GetByID(uint32(2)).Return(&user.User{ID: 2, Login: "qwe", Role: "user"}, nil)
+	ses.EXPECT().DestroyByUser(uint32(2)).Return(int64(2), nil)
+	ses.EXPECT().RevokeTokens(uint32(2), gomock.Any()).Return(nil)
+	w := httptest.NewRecorder()
+	service.Logout(w, adminRequest("POST", "2", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if w.Code != http.StatusOK || !bytes.Contains(body, []byte(`"sessions":2`)) {
+		t.Errorf("bad response: %d %s", w.Code, body)
+	}
+
+	st.EXPECT().GetByID(uint32(9)).Return(nil, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Logout(w, adminRequest("POST", "9", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bad status: %d", w.Code)
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/errorsForProject"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/session"
+	"time"
+)
+
+var (
+	errNotDeleted = errors.New(" not deleted")
+	errExpired    = errors.New(" retention window has passed")
+)
+
+// Delete удаляет пост мягко: из лент он пропадает, но до очистки его можно восстановить.
+// В теле можно передать причину {"reason": "..."}
+func (h *PostsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p, err := session.PrincipalFromContext(r.Context())
+	if !authorized(w, err, "DELETE: ", h.Logger) {
+		return
+	}
+	post, err := h.livePost(vars["POST_ID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "DELETE: "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
+	if !authorized(w, authz.CanModifyPost(p, post), "DELETE: ", h.Logger) {
+		h.Logger.Infow("delete post forbidden", "user", p.UserID, "post", post.ID)
+		return
+	}
+	fd, ok := h.deleteForm(w, r, "DELETE: ")
+	if !ok {
+		return
+	}
+	deleter, errForm := GetUserForm(w, r, h.Logger)
+	if errForm != nil {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	post.DeletedAt, post.DeletedBy, post.DeleteReason = &now, &deleter, fd.Reason
+	if _, err = h.PostRepo.Update(post, posts.DeletionFields...); err != nil {
+		h.Logger.Errorw("cant delete post", "post", post.ID, "err", err)
+		JsonError(w, http.StatusBadRequest, "DELETE: "+errorsForProject.ErrCantDelete.Error(), h.Logger)
+		return
+	}
+
+	resp, err := json.Marshal(map[string]string{
+		"message": "success",
+	})
+	if err != nil {
+		JsonError(w, http.StatusBadRequest, "DELETE: "+errorsForProject.ErrCantMarshal.Error(), h.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	h.Logger.Infow("deleted post", "post", post.ID, "user", p.UserID, "reason", fd.Reason)
+}
+
+// DeleteComment удаляет комментарий мягко: в треде остается заглушка "[deleted]".
+// Меняется только сам комментарий, а не весь массив, чтобы не потерять параллельные правки треда
+func (h *PostsHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p, err := session.PrincipalFromContext(r.Context())
+	if !authorized(w, err, "DeleteComment: ", h.Logger) {
+		return
+	}
+	post, err := h.livePost(vars["POST_ID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "DeleteComment: "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
+	comment := findComment(post.Comments, vars["COMMENT_ID"])
+	if comment == nil || comment.Deleted() {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "DeleteComment: "+errorsForProject.ErrCantDelete.Error(), h.Logger)
+		return
+	}
+	if !authorized(w, authz.CanModifyComment(p, post, comment), "DeleteComment: ", h.Logger) {
+		h.Logger.Infow("delete comment forbidden", "user", p.UserID, "post", post.ID, "comment", comment.ID)
+		return
+	}
+	fd, ok := h.deleteForm(w, r, "DeleteComment: ")
+	if !ok {
+		return
+	}
+	deleter, errForm := GetUserForm(w, r, h.Logger)
+	if errForm != nil {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	post1, err := h.PostRepo.SetCommentDeletion(post.ID, comment.ID, &now, &deleter, fd.Reason)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, "DeleteComment: "+err.Error(), h.Logger)
+		return
+	}
+	SendRequest(w, "DeleteComment: ", post1, http.StatusOK, h.Logger)
+
+	h.Logger.Infow("deleted comment", "comment", comment.ID, "post", post.ID, "user", p.UserID, "reason", fd.Reason)
+}
+
+// RestorePost возвращает удаленный пост, пока не прошло Retention с удаления
+func (h *PostsHandler) RestorePost(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p, err := session.PrincipalFromContext(r.Context())
+	if !authorized(w, err, "Restore: ", h.Logger) {
+		return
+	}
+	post, err := h.PostRepo.GetByID(vars["POST_ID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "Restore: "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
+	// сначала права: посторонний не должен узнать, удален ли пост и истек ли срок
+	if !authorized(w, authz.CanRestorePost(p, post), "Restore: ", h.Logger) {
+		h.Logger.Infow("restore post forbidden", "user", p.UserID, "post", post.ID)
+		return
+	}
+	if !h.restorable(w, post.DeletedAt, "Restore: ") {
+		return
+	}
+
+	post.DeletedAt, post.DeletedBy, post.DeleteReason = nil, nil, ""
+	res, err := h.PostRepo.Update(post, posts.DeletionFields...)
+	if err != nil {
+		h.Logger.Errorw("cant restore post", "post", post.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "Restore: cant restore post", h.Logger)
+		return
+	}
+	SendRequest(w, "Restore: ", res, http.StatusOK, h.Logger)
+	h.Logger.Infow("restored post", "post", post.ID, "user", p.UserID)
+}
+
+// RestoreComment - то же для комментария. Пост при этом должен быть не удален
+func (h *PostsHandler) RestoreComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p, err := session.PrincipalFromContext(r.Context())
+	if !authorized(w, err, "Restore Comment: ", h.Logger) {
+		return
+	}
+	post, err := h.livePost(vars["POST_ID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "Restore Comment: "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
+	comment := findComment(post.Comments, vars["COMMENT_ID"])
+	if comment == nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "Restore Comment: no comment found", h.Logger)
+		return
+	}
+	if !authorized(w, authz.CanRestoreComment(p, post, comment), "Restore Comment: ", h.Logger) {
+		h.Logger.Infow("restore comment forbidden", "user", p.UserID, "post", post.ID, "comment", comment.ID)
+		return
+	}
+	if !h.restorable(w, comment.DeletedAt, "Restore Comment: ") {
+		return
+	}
+
+	res, err := h.PostRepo.SetCommentDeletion(post.ID, comment.ID, nil, nil, "")
+	if err != nil {
+		h.Logger.Errorw("cant restore comment", "post", post.ID, "comment", comment.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "Restore Comment: cant restore comment", h.Logger)
+		return
+	}
+	SendRequest(w, "Restore Comment: ", res, http.StatusOK, h.Logger)
+	h.Logger.Infow("restored comment", "comment", comment.ID, "post", post.ID, "user", p.UserID)
+}
+
+// restorable отвечает 409, если восстанавливать нечего, и 410, если срок хранения вышел
+func (h *PostsHandler) restorable(w http.ResponseWriter, deletedAt *time.Time, errStr string) bool {
+	switch {
+	case deletedAt == nil:
+		w.WriteHeader(http.StatusConflict)
+		JsonError(w, http.StatusConflict, errStr+errNotDeleted.Error(), h.Logger)
+		return false
+	case time.Since(*deletedAt) > h.Retention:
+		w.WriteHeader(http.StatusGone)
+		JsonError(w, http.StatusGone, errStr+errExpired.Error(), h.Logger)
+		return false
+	}
+	return true
+}
+
+// deleteForm читает необязательную причину удаления, пустое тело - без причины
+func (h *PostsHandler) deleteForm(w http.ResponseWriter, r *http.Request, errStr string) (*forms.DeleteForm, bool) {
+	fd := &forms.DeleteForm{}
+	if err := json.NewDecoder(r.Body).Decode(fd); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, errStr+"Cant Decode", h.Logger)
+		return nil, false
+	}
+	if errs := fd.Validate(); len(errs) > 0 {
+		SendValidationErrors(w, errs, h.Logger)
+		return nil, false
+	}
+	return fd, true
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/session"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeletePost(t *testing.T) {
+	service, post, _ := newMemService(t)
+	author := &session.Principal{UserID: 1, Login: "ata", Role: "user"}
+	stranger := &session.Principal{UserID: 2, Login: "qwe", Role: "user"}
+	vars := map[string]string{"POST_ID": post.ID}
+
+	tooLong := `{"reason":"` + strings.Repeat("a", forms.ReasonMaxLen+1) + `"}`
+	assert.Equal(t, http.StatusUnprocessableEntity, call(service.Delete, "DELETE", vars, tooLong, author).Code)
+	assert.Equal(t, http.StatusBadRequest, call(service.Delete, "DELETE", vars, `{"reason":`, author).Code)
+	require.Equal(t, http.StatusOK, call(service.Delete, "DELETE", vars, `{"reason":"typo"}`, author).Code)
+
+	stored, err := service.PostRepo.GetByID(post.ID)
+	require.NoError(t, err)
+	require.True(t, stored.Deleted())
+	assert.Equal(t, "ata", stored.DeletedBy.Login)
+	assert.Equal(t, "typo", stored.DeleteReason)
+
+	// удаленного поста нет ни в ленте, ни по ссылке
+	w := call(service.GetAllPosts, "GET", nil, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"title":"qwe"`)
+	assert.Contains(t, w.Body.String(), `"title":"link"`)
+	assert.Contains(t, call(service.GetPost, "GET", vars, "", nil).Body.String(), posts.ErrNoPost.Error())
+	assert.Equal(t, http.StatusNotFound, call(service.Delete, "DELETE", vars, "", author).Code)
+	assert.Equal(t, http.StatusNotFound, call(service.Edit, "PATCH", vars, `{"text":"new text"}`, author).Code)
+	assert.Equal(t, http.StatusNotFound, call(service.Revisions, "GET", vars, "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(service.Upvote, "POST", vars, "", author).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, call(service.RestorePost, "POST", vars, "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, call(service.RestorePost, "POST", vars, "", stranger).Code)
+	w = call(service.RestorePost, "POST", vars, "", author)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"deleted"`)
+	assert.Equal(t, http.StatusConflict, call(service.RestorePost, "POST", vars, "", author).Code)
+	assert.Equal(t, http.StatusForbidden, call(service.RestorePost, "POST", vars, "", stranger).Code)
+
+	w = call(service.GetAllPosts, "GET", nil, "", nil)
+	assert.Contains(t, w.Body.String(), `"title":"qwe"`)
+}
+
+func TestRestoreAfterModerator(t *testing.T) {
+	service, post, _ := newMemService(t)
+	author := &session.Principal{UserID: 1, Login: "ata", Role: "user"}
+	moderator := &session.Principal{UserID: 4, Login: "mod", Role: "moderator", Categories: []string{"music"}}
+	vars := map[string]string{"POST_ID": post.ID}
+
+	require.Equal(t, http.StatusOK, call(service.Delete, "DELETE", vars, `{"reason":"spam"}`, moderator).Code)
+	// снятое модератором автор сам не возвращает
+	assert.Equal(t, http.StatusForbidden, call(service.RestorePost, "POST", vars, "", author).Code)
+	assert.Equal(t, http.StatusOK, call(service.RestorePost, "POST", vars, "", moderator).Code)
+
+	assert.Equal(t, http.StatusNotFound, call(service.RestorePost, "POST", map[string]string{"POST_ID": "42"}, "", moderator).Code)
+}
+
+func TestRestoreRetention(t *testing.T) {
+	service, post, _ := newMemService(t)
+	author := &session.Principal{UserID: 1, Login: "ata", Role: "user"}
+	vars := map[string]string{"POST_ID": post.ID}
+
+	deleted := time.Now().Add(-2 * service.Retention)
+	post.DeletedAt, post.DeletedBy = &deleted, &post.CreatedBy
+	_, err := service.PostRepo.Update(post, posts.DeletionFields...)
+	require.NoError(t, err)
+
+	// посторонний про срок хранения не узнает
+	assert.Equal(t, http.StatusForbidden, call(service.RestorePost, "POST", vars, "",
+		&session.Principal{UserID: 2, Login: "qwe", Role: "user"}).Code)
+	assert.Equal(t, http.StatusGone, call(service.RestorePost, "POST", vars, "", author).Code)
+	stored, err := service.PostRepo.GetByID(post.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Deleted())
+}
+
+func TestSoftDeleteComment(t *testing.T) {
+	service, post, _ := newMemService(t)
+	commenter := &session.Principal{UserID: 3, Login: "rita", Role: "user"}
+	postAuthor := &session.Principal{UserID: 1, Login: "ata", Role: "user"}
+	vars := map[string]string{"POST_ID": post.ID, "COMMENT_ID": "1"}
+
+	w := call(service.DeleteComment, "DELETE", vars, "", commenter)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNotFound, call(service.DeleteComment, "DELETE", vars, "", commenter).Code)
+	assert.Equal(t, http.StatusNotFound, call(service.DeleteComment, "DELETE",
+		map[string]string{"POST_ID": "42", "COMMENT_ID": "1"}, "", commenter).Code)
+
+	// заглушка на месте комментария, ответы под ним не теряются
+	w = call(service.GetPost, "GET", vars, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"[deleted]"`)
+	assert.Contains(t, w.Body.String(), `"author":{"id":"","username":"[deleted]"}`)
+	assert.NotContains(t, w.Body.String(), "zxc")
+	assert.NotContains(t, w.Body.String(), "rita")
+
+	assert.Equal(t, http.StatusForbidden, call(service.RestoreComment, "POST", vars, "", postAuthor).Code)
+	assert.Equal(t, http.StatusNotFound, call(service.RestoreComment, "POST",
+		map[string]string{"POST_ID": post.ID, "COMMENT_ID": "2"}, "", commenter).Code)
+	w = call(service.RestoreComment, "POST", vars, "", commenter)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"zxc"`)
+	assert.Equal(t, http.StatusConflict, call(service.RestoreComment, "POST", vars, "", commenter).Code)
+}
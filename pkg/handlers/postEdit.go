@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/errorsForProject"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/session"
+	"time"
+)
+
+// Edit - PUT заменяет тело поста (text или url по типу), PATCH меняет только переданные поля.
+// Заголовок меняется только в первые TitleEditWindow после публикации.
+// Прежняя версия уходит в историю, пост помечается edited
+func (h *PostsHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p, err := session.PrincipalFromContext(r.Context())
+	if !authorized(w, err, "Edit: ", h.Logger) {
+		return
+	}
+	post, err := h.livePost(vars["POST_ID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "Edit: "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
+	if !authorized(w, authz.CanEditPost(p, post), "Edit: ", h.Logger) {
+		h.Logger.Infow("edit post forbidden", "user", p.UserID, "post", post.ID)
+		return
+	}
+
+	fd := &forms.PostEditForm{}
+	if err = json.NewDecoder(r.Body).Decode(fd); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, "Edit: Cant Decode", h.Logger)
+		return
+	}
+	if errs := fd.Validate(post.Type, r.Method == http.MethodPatch); len(errs) > 0 {
+		SendValidationErrors(w, errs, h.Logger)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	edited := *post
+	if fd.Title != nil && *fd.Title != post.Title {
+		if now.Sub(post.CreatedAt) > h.TitleEditWindow {
+			SendValidationErrors(w, []errorsForProject.RegisterError{{
+				Location: "body",
+				Param:    "title",
+				Value:    *fd.Title,
+				Msg:      fmt.Sprintf("can be changed only within %s after posting", h.TitleEditWindow),
+			}}, h.Logger)
+			return
+		}
+		edited.Title = *fd.Title
+	}
+	if fd.Text != nil {
+		edited.Text = *fd.Text
+	}
+	if fd.Url != nil {
+		edited.URL = *fd.Url
+	}
+	if edited.Title == post.Title && edited.Text == post.Text && edited.URL == post.URL {
+		SendRequest(w, "Edit: ", post, http.StatusOK, h.Logger)
+		return
+	}
+
+	editor, errForm := GetUserForm(w, r, h.Logger)
+	if errForm != nil {
+		return
+	}
+	err = h.RevisionRepo.Add(&posts.Revision{
+		PostID:   post.ID,
+		EditedBy: editor,
+		EditedAt: now,
+		Title:    post.Title,
+		Text:     post.Text,
+		URL:      post.URL,
+	})
+	if err != nil {
+		h.Logger.Errorw("cant save revision", "post", post.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "Edit: cant save revision", h.Logger)
+		return
+	}
+
+	edited.EditedAt = &now
+	res, err := h.PostRepo.Update(&edited, posts.FieldTitle, posts.FieldText, posts.FieldURL, posts.FieldEdited)
+	if err != nil {
+		h.Logger.Errorw("cant update post", "post", post.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "Edit: cant update post", h.Logger)
+		return
+	}
+	SendRequest(w, "Edit: ", res, http.StatusOK, h.Logger)
+	h.Logger.Infow("edited post", "post", post.ID, "user", p.UserID)
+}
+
+// Revisions - прежние версии поста, последние первыми
+func (h *PostsHandler) Revisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	post, err := h.livePost(vars["POST_ID"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, "Revisions: "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
+	revs, err := h.RevisionRepo.List(post.ID)
+	if err != nil {
+		h.Logger.Errorw("cant list revisions", "post", post.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "Revisions: cant list revisions", h.Logger)
+		return
+	}
+	resp, err := json.Marshal(revs)
+	if err != nil {
+		JsonError(w, http.StatusBadRequest, "Revisions: "+errorsForProject.ErrCantMarshal.Error(), h.Logger)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
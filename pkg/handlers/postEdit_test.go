@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/session"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditPost(t *testing.T) {
+	service, text, link := newMemService(t)
+	author := &session.Principal{UserID: 1, Login: "ata", Role: "user"}
+	editPost := func(method, postID, body string, p *session.Principal) *httptest.ResponseRecorder {
+		return call(service.Edit, method, map[string]string{"POST_ID": postID}, body, p)
+	}
+
+	// править может только автор, даже админ - нет
+	assert.Equal(t, http.StatusUnauthorized, editPost("PATCH", text.ID, `{"text":"new text"}`, nil).Code)
+	assert.Equal(t, http.StatusForbidden, editPost("PATCH", text.ID, `{"text":"new text"}`,
+		&session.Principal{UserID: 2, Login: "admin", Role: "admin"}).Code)
+	assert.Equal(t, http.StatusNotFound, editPost("PATCH", "42", `{"text":"new text"}`, author).Code)
+	assert.Equal(t, http.StatusBadRequest, editPost("PATCH", text.ID, `{"text":`, author).Code)
+
+	// PUT требует тело, url у текстового поста не меняется
+	assert.Equal(t, http.StatusUnprocessableEntity, editPost("PUT", text.ID, `{"title":"new"}`, author).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, editPost("PATCH", text.ID, `{"url":"https://a.ru"}`, author).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, editPost("PATCH", link.ID, `{"text":"new text"}`, author).Code)
+
+	w := editPost("PATCH", text.ID, `{"text":"new text"}`, author)
+	require.Equal(t, http.StatusOK, w.Code)
+	got := &posts.Post{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), got))
+	assert.Equal(t, "new text", got.Text)
+	assert.Equal(t, "qwe", got.Title)
+	require.NotNil(t, got.EditedAt)
+	assert.Contains(t, w.Body.String(), `"edited":"`)
+
+	// заголовок в пределах окна, ссылка - через PUT
+	w = editPost("PUT", text.ID, `{"title":"new title","text":"new text"}`, author)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = editPost("PUT", link.ID, `{"url":"https://poka.ru"}`, author)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// без изменений история не растет
+	w = editPost("PATCH", text.ID, `{"title":"new title"}`, author)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	stored, err := service.PostRepo.GetByID(text.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new title", stored.Title)
+	assert.Equal(t, "new text", stored.Text)
+
+	revs, err := service.RevisionRepo.List(text.ID)
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	assert.Equal(t, 2, revs[0].Number)
+	assert.Equal(t, "qwe", revs[0].Title)
+	assert.Equal(t, "new text", revs[0].Text)
+	assert.Equal(t, 1, revs[1].Number)
+	assert.Equal(t, "privet", revs[1].Text)
+	assert.Equal(t, forms.UserForm{ID: "1", Login: "ata"}, revs[1].EditedBy)
+
+	// после окна заголовок не меняется, текст - да
+	old := &posts.Post{ID: "old", Category: "music", Title: "old", Type: "text", Text: "privet",
+		CreatedBy: text.CreatedBy, CreatedAt: time.Now().Add(-time.Hour)}
+	require.NoError(t, service.PostRepo.Db.Add(old))
+	w = editPost("PATCH", old.ID, `{"title":"late title"}`, author)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "can be changed only within 1m0s")
+	assert.Equal(t, http.StatusOK, editPost("PATCH", old.ID, `{"text":"late text"}`, author).Code)
+}
+
+func TestPostRevisions(t *testing.T) {
+	service, text, _ := newMemService(t)
+	author := &session.Principal{UserID: 1, Login: "ata", Role: "user"}
+	require.Equal(t, http.StatusOK, call(service.Edit, "PATCH", map[string]string{"POST_ID": text.ID}, `{"text":"new text"}`, author).Code)
+
+	list := func(postID string) *httptest.ResponseRecorder {
+		return call(service.Revisions, "GET", map[string]string{"POST_ID": postID}, "", nil)
+	}
+	w := list(text.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	revs := []*posts.Revision{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revs))
+	require.Len(t, revs, 1)
+	assert.Equal(t, "privet", revs[0].Text)
+	assert.Equal(t, "ata", revs[0].EditedBy.Login)
+
+	assert.Equal(t, http.StatusNotFound, list("42").Code)
+}
@@ -2,16 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
+	"net/url"
+	"redditclone/pkg/authz"
 	"redditclone/pkg/comments"
 	"redditclone/pkg/errorsForProject"
 	"redditclone/pkg/forms"
 	"redditclone/pkg/posts"
 	"redditclone/pkg/posts/repo"
+	"redditclone/pkg/ranking"
 	"redditclone/pkg/session"
 	"strconv"
 	"strings"
@@ -22,17 +25,143 @@ type PostsHandler struct {
 	Logger         *zap.SugaredLogger
 	PostRepo       repo.MyRepo
 	SessionManager session.SessionRepo
+	// RevisionRepo хранит прежние версии постов при правке
+	RevisionRepo posts.RevisionRepo
+	// TitleEditWindow - сколько после публикации автор может менять заголовок
+	TitleEditWindow time.Duration
+	// Retention - сколько после удаления пост или комментарий можно восстановить
+	Retention time.Duration
 }
 
 // ВСЕ ГЕТТЕРЫ
 
+// размер страницы ленты: по умолчанию, если задан только курсор, и наибольший для ?limit=
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+var errBadLimit = errors.New(" limit must be a positive number")
+
+// feedQuery разбирает ?sort= (hot, top, new, rising, controversial), ?t= (hour ... year, all),
+// ?limit= и курсоры ?after= или ?before= из прошлой страницы. Без ?limit= и курсоров
+// лента целиком, как раньше: на это рассчитан фронт
+func feedQuery(r *http.Request) (posts.FeedQuery, error) {
+	params := r.URL.Query()
+	q := posts.FeedQuery{
+		Sort: params.Get("sort"),
+	}
+	if params.Get("after") != "" || params.Get("before") != "" {
+		q.Limit = defaultPageSize
+	}
+	if _, err := ranking.Get(q.Sort); err != nil {
+		return q, err
+	}
+	window, err := ranking.ParseWindow(params.Get("t"))
+	if err != nil {
+		return q, err
+	}
+	q.Window = window
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return q, errBadLimit
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		q.Limit = n
+	}
+	if after := params.Get("after"); after != "" {
+		if q.After, err = posts.DecodeCursor(after); err != nil {
+			return q, err
+		}
+	}
+	if before := params.Get("before"); before != "" {
+		if q.Before, err = posts.DecodeCursor(before); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// feedPageResponse - страница ленты с курсорами соседних страниц для ?after= и ?before=
+type feedPageResponse struct {
+	Posts []*posts.Post `json:"posts"`
+	Next  string        `json:"next,omitempty"`
+	Prev  string        `json:"prev,omitempty"`
+}
+
+// feed отвечает лентой. Без пагинации - массивом постов, как раньше. Страница - объектом
+// feedPageResponse, а ссылки на соседние страницы дублируются в заголовке Link
+// (rel="next" и rel="prev"). Ошибки запроса - 400
+func (h *PostsHandler) feed(w http.ResponseWriter, r *http.Request, q posts.FeedQuery, errStr string) {
+	page, err := h.PostRepo.FeedPage(q)
+	if errors.Is(err, ranking.ErrUnknownSort) || errors.Is(err, posts.ErrBadCursor) {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, errStr+err.Error(), h.Logger)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorw("cant load feed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, errStr+"cant load feed", h.Logger)
+		return
+	}
+	if q.Limit == 0 {
+		SendSliceRequest(w, errStr, page.Posts, http.StatusOK, h.Logger)
+		return
+	}
+
+	res := feedPageResponse{Posts: page.Posts}
+	if page.Next != nil {
+		res.Next = page.Next.Encode()
+	}
+	if page.Prev != nil {
+		res.Prev = page.Prev.Encode()
+	}
+	resp, err := json.Marshal(res)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, errStr+errorsForProject.ErrCantMarshal.Error(), h.Logger)
+		return
+	}
+	if links := pageLinks(r, page); links != "" {
+		w.Header().Set("Link", links)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// pageLinks - ссылки на соседние страницы с теми же параметрами запроса
+func pageLinks(r *http.Request, page *posts.FeedPage) string {
+	links := make([]string, 0, 2)
+	link := func(param string, c *posts.Cursor, rel string) {
+		params := r.URL.Query()
+		params.Del("after")
+		params.Del("before")
+		params.Set(param, c.Encode())
+		u := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", u.String(), rel))
+	}
+	if page.Next != nil {
+		link("after", page.Next, "next")
+	}
+	if page.Prev != nil {
+		link("before", page.Prev, "prev")
+	}
+	return strings.Join(links, ", ")
+}
+
 func (h *PostsHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
-	res, err := h.PostRepo.GetAll()
+	q, err := feedQuery(r)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		JsonError(w, http.StatusBadRequest, "GetALLPost: "+err.Error(), h.Logger)
 		return
 	}
-	SendSliceRequest(w, "Get AllPosts: ", res, http.StatusOK, h.Logger)
+	h.feed(w, r, q, "GetALLPost: ")
 
 	h.Logger.Infof("Get AllPosts: %v", http.StatusOK)
 	return
@@ -40,34 +169,29 @@ func (h *PostsHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostsHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	res, err := h.PostRepo.GetPostsCategory(vars["CATEGORY_NAME"])
+	q, err := feedQuery(r)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		JsonError(w, http.StatusBadRequest, "GetCategoryPost: "+err.Error(), h.Logger)
 		return
 	}
-	SendSliceRequest(w, "Get Category: ", res, http.StatusOK, h.Logger)
+	q.Category = vars["CATEGORY_NAME"]
+	h.feed(w, r, q, "GetCategoryPost: ")
 
 	h.Logger.Infof("Get Category: %v", http.StatusOK)
 	return
 }
 
 func (h *PostsHandler) GetUserPost(w http.ResponseWriter, r *http.Request) {
-	ses, err := h.SessionManager.Check(r)
 	vars := mux.Vars(r)
+	q, err := feedQuery(r)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		JsonError(w, http.StatusBadRequest, "GetUserPost: "+err.Error(), h.Logger)
 		return
 	}
-	userForm := forms.UserForm{
-		ID:    strconv.Itoa(int(ses.UserID)),
-		Login: vars["USER_LOGIN"],
-	}
-	res, err := h.PostRepo.GetPostsByUser(userForm)
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "GetUserPost: "+err.Error(), h.Logger)
-		return
-	}
-	SendSliceRequest(w, "Get UserPost: ", res, http.StatusOK, h.Logger)
+	q.Author = vars["USER_LOGIN"]
+	h.feed(w, r, q, "GetUserPost: ")
 
 	h.Logger.Infof("Get UserPost: %v", http.StatusOK)
 	return
@@ -75,16 +199,10 @@ func (h *PostsHandler) GetUserPost(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostsHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	post, err := h.PostRepo.GetByID(vars["POST_ID"])
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "GetPost: "+posts.ErrNoPost.Error(), h.Logger)
-		return
-	}
-	h.PostRepo.IncreaseViews(post)
-
-	_, err = h.PostRepo.Update(post)
+	// просмотр считает хранилище, иначе параллельные запросы теряют инкременты
+	post, err := h.PostRepo.AddView(vars["POST_ID"])
 	if err != nil {
-		JsonError(w, http.StatusBadRequest, "AddComment update: "+err.Error(), h.Logger)
+		JsonError(w, http.StatusBadRequest, "GetPost: "+err.Error(), h.Logger)
 		return
 	}
 
@@ -106,19 +224,22 @@ func (h *PostsHandler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userForm, _, errForm := GetUserForm(w, r, h.Logger) // получение юзера и времени, ошибка отправляется прям там
+	userForm, errForm := GetUserForm(w, r, h.Logger) // получение юзера, ошибка отправляется прям там
 	if errForm != nil {
 		return
 	}
+	if errs := fd.Validate(); len(errs) > 0 {
+		SendValidationErrors(w, errs, h.Logger)
+		return
+	}
 	newPost = &posts.Post{
-		Category:    fd.Category,
-		Title:       fd.Title,
-		CreatedBy:   userForm,
-		Type:        fd.TypeOfPost,
-		CurrentTime: "2",
+		Category:  fd.Category,
+		Title:     fd.Title,
+		CreatedBy: userForm,
+		Type:      fd.TypeOfPost,
 	}
 
-	if fd.TypeOfPost == "text" {
+	if fd.TypeOfPost == forms.PostTypeText {
 		newPost.Text = fd.Text
 	} else {
 		newPost.URL = fd.Url
@@ -141,34 +262,11 @@ func (h *PostsHandler) Add(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (h *PostsHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	isSuccess := h.PostRepo.Delete(vars["POST_ID"])
-	if !isSuccess {
-		JsonError(w, http.StatusBadRequest, "DELETE: "+errorsForProject.ErrCantDelete.Error(), h.Logger)
-		return
-	}
-
-	resp, err := json.Marshal(map[string]string{
-		"message": "success",
-	})
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "DELETE: "+errorsForProject.ErrCantMarshal.Error(), h.Logger)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
-	h.Logger.Infof("Deleted Post: %v", vars["POST_ID"])
-	return
-
-}
-
 //  ДОБАВЛЕНИЕ ИЛИ УДАЛЕНИЕ КОММЕНТАРИЯ
 
 func (h *PostsHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	post, err := h.PostRepo.GetByID(vars["POST_ID"])
+	post, err := h.livePost(vars["POST_ID"])
 	if err != nil {
 		JsonError(w, http.StatusBadRequest, "AddComment: "+posts.ErrNoPost.Error(), h.Logger)
 		return
@@ -198,22 +296,20 @@ func (h *PostsHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userForm, _, errForm := GetUserForm(w, r, h.Logger) // получение юзера и времени, ошибка отправляется прям там
+	userForm, errForm := GetUserForm(w, r, h.Logger) // получение юзера, ошибка отправляется прям там
 	if errForm != nil {
 		return
 	}
 
+	// id комментарию выдает хранилище, иначе параллельные комментарии затирают друг друга
 	newComment := &comments.Comment{
-		ID:          strconv.Itoa(post.ComCount + 1),
 		CreatedBy:   userForm,
 		Description: fd.Description,
-		CurrentTime: "2",
+		CreatedAt:   time.Now().UTC().Truncate(time.Millisecond),
 	}
-	post.ComCount++
-	post.Comments = append(post.Comments, *newComment)
-	post1, err := h.PostRepo.Update(post)
+	post1, err := h.PostRepo.AddComment(post.ID, newComment)
 	if err != nil {
-		JsonError(w, http.StatusBadRequest, "AddComment update: "+err.Error(), h.Logger)
+		JsonError(w, http.StatusBadRequest, "AddComment: "+err.Error(), h.Logger)
 		return
 	}
 
@@ -222,116 +318,82 @@ func (h *PostsHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (h *PostsHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	post, err := h.PostRepo.GetByID(vars["POST_ID"])
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "AddComment: "+posts.ErrNoPost.Error(), h.Logger)
-		return
-	}
-	pos, IsSuccess := comments.Delete(post.Comments, vars["COMMENT_ID"])
-	if !IsSuccess {
-		JsonError(w, http.StatusBadRequest, "Delete Comment: "+errorsForProject.ErrCantDelete.Error(), h.Logger)
-		return
-	}
-	post.Comments = pos
-	post1, err := h.PostRepo.Update(post)
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err.Error(), h.Logger)
-		return
-	}
-	SendRequest(w, "Delete Comment: ", post1, http.StatusOK, h.Logger)
-
-	h.Logger.Infof("Deleted comment: %v with PostID: %v", vars["COMMENT_ID"], vars["POST_ID"])
-	return
-}
-
 // ФУНКЦИИ С VOTE
 
 func (h *PostsHandler) Upvote(w http.ResponseWriter, r *http.Request) {
-	fd, post, userId, postId, err1 := GetParamForVote(w, r, h, 1)
-	if err1 != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err1.Error(), h.Logger)
-		return
-	}
-	resp := h.PostRepo.IncreaseVote(fd, post)
-	post1, err := h.PostRepo.Update(resp)
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err.Error(), h.Logger)
-		return
-	}
-
-	SendRequest(w, "Upvote: ", post1, http.StatusOK, h.Logger)
-
-	h.Logger.Infof("Upvote with UserId: %v with PostID: %v", userId, postId)
-	return
+	h.vote(w, r, 1, "Upvote")
 }
 
 func (h *PostsHandler) Downvote(w http.ResponseWriter, r *http.Request) {
-	fd, post, userId, postId, err1 := GetParamForVote(w, r, h, -1)
-	if err1 != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err1.Error(), h.Logger)
-		return
-	}
-	resp := h.PostRepo.IncreaseVote(fd, post)
-	_, err := h.PostRepo.Update(resp)
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err.Error(), h.Logger)
-		return
-	}
-
-	SendRequest(w, "Downvote: ", resp, http.StatusOK, h.Logger)
-
-	h.Logger.Infof("Downvote with UserId: %v with PostID: %v", userId, postId)
-	return
+	h.vote(w, r, -1, "Downvote")
 }
 
 func (h *PostsHandler) Unvote(w http.ResponseWriter, r *http.Request) {
-	fd, post, userId, postId, err1 := GetParamForVote(w, r, h, 0)
-	if err1 != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err1.Error(), h.Logger)
+	h.vote(w, r, 0, "Unvote")
+}
+
+// vote меняет голос одной операцией хранилища, без чтения поста и последующего Update,
+// иначе параллельные голосования затирают друг друга
+func (h *PostsHandler) vote(w http.ResponseWriter, r *http.Request, value int, action string) {
+	vars := mux.Vars(r)
+	userForm, errForm := GetUserForm(w, r, h.Logger) // получение юзера и времени, ошибка отправляется прям там
+	if errForm != nil {
 		return
 	}
 
-	resp := h.PostRepo.DecreaseVote(fd, post)
-	_, err := h.PostRepo.Update(post)
+	post, err := h.PostRepo.ApplyVote(vars["POST_ID"], userForm.ID, value)
+	if errors.Is(err, posts.ErrNoPost) {
+		w.WriteHeader(http.StatusNotFound)
+		JsonError(w, http.StatusNotFound, action+": "+posts.ErrNoPost.Error(), h.Logger)
+		return
+	}
 	if err != nil {
-		JsonError(w, http.StatusBadRequest, "Delete comment update: "+err.Error(), h.Logger)
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, action+": "+err.Error(), h.Logger)
 		return
 	}
 
-	SendRequest(w, "Unvote: ", resp, http.StatusOK, h.Logger)
+	SendRequest(w, action+": ", post, http.StatusOK, h.Logger)
 
-	h.Logger.Infof("Unvote with UserId: %v with PostID: %v", userId, postId)
-	return
+	h.Logger.Infof("%s with UserId: %v with PostID: %v", action, userForm.ID, vars["POST_ID"])
 }
 
 // СТОРОННИЕ ФУНКЦИИ
 
-func GetParamForVote(w http.ResponseWriter, r *http.Request, h *PostsHandler, vote int) (fd *forms.VoteForm, post *posts.Post, UserId string, postId string, errAns error) {
-	vars := mux.Vars(r)
-	post, err := h.PostRepo.GetByID(vars["POST_ID"])
-	if err != nil {
-		JsonError(w, http.StatusBadRequest, "AddComment: "+posts.ErrNoPost.Error(), h.Logger)
-		return nil, nil, "", "", fmt.Errorf("no user")
-	}
-	userForm, _, errForm := GetUserForm(w, r, h.Logger) // получение юзера и времени, ошибка отправляется прям там
-	if errForm != nil {
-		return nil, nil, "", "", fmt.Errorf("no user")
+// authorized отвечает 401, если пользователь не установлен, и 403, если ему нельзя. true - можно продолжать
+func authorized(w http.ResponseWriter, err error, errStr string, Logger *zap.SugaredLogger) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authz.ErrForbidden):
+		w.WriteHeader(http.StatusForbidden)
+		JsonError(w, http.StatusForbidden, errStr+err.Error(), Logger)
+	default:
+		w.WriteHeader(http.StatusUnauthorized)
+		JsonError(w, http.StatusUnauthorized, errStr+err.Error(), Logger)
 	}
-	fd = &forms.VoteForm{
-		ID: userForm.ID,
+	return false
+}
+
+// livePost - пост по id. Удаленный для всех, кроме восстановления, считается отсутствующим
+func (h *PostsHandler) livePost(id string) (*posts.Post, error) {
+	post, err := h.PostRepo.GetByID(id)
+	if err != nil {
+		return nil, err
 	}
-	switch vote {
-	case 1:
-		fd.Vote = 1
-	case -1:
-		fd.Vote = -1
-	default:
-		fd.Vote = 0
+	if post.Deleted() {
+		return nil, posts.ErrNoPost
 	}
+	return post, nil
+}
 
-	return fd, post, userForm.ID, vars["POST_ID"], nil
+func findComment(list []comments.Comment, id string) *comments.Comment {
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i]
+		}
+	}
+	return nil
 }
 
 func SendSliceRequest(w http.ResponseWriter, errStr string, res []*posts.Post, status int, Logger *zap.SugaredLogger) {
@@ -355,30 +417,17 @@ func SendRequest(w http.ResponseWriter, errStr string, post *posts.Post, status
 	w.Write(resp)
 }
 
-func GetUserForm(w http.ResponseWriter, r *http.Request, Logger *zap.SugaredLogger) (forms.UserForm, []byte, error) {
-	tokenString := r.Header.Get("Authorization")
-	tokenString = tokenString[strings.Index(tokenString, " ")+1:]
-
-	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return TokenSecret, nil
-	})
+// GetUserForm достает пользователя, которого положил в контекст middleware.Auth.
+// Если его нет, сразу отвечает 401
+func GetUserForm(w http.ResponseWriter, r *http.Request, Logger *zap.SugaredLogger) (forms.UserForm, error) {
+	p, err := session.PrincipalFromContext(r.Context())
 	if err != nil {
-		JsonError(w, http.StatusBadRequest, "GetUserForm: cant token parse", Logger)
-		return forms.UserForm{}, []byte{}, err
-	}
-
-	in := claims["user"]
-	ourUser := in.(map[string]interface{}) // map с login и Id юзера из токена
-
-	timing, errTime := time.Now().UTC().MarshalText()
-	if errTime != nil {
-		JsonError(w, http.StatusBadRequest, "Time.MarshalText: year outside of range [0,9999]", Logger)
-		return forms.UserForm{}, []byte{}, err
-	}
-	res := forms.UserForm{
-		ID:    fmt.Sprint(ourUser["id"]),
-		Login: ourUser["username"].(string),
-	}
-	return res, timing, nil
+		w.WriteHeader(http.StatusUnauthorized)
+		JsonError(w, http.StatusUnauthorized, "GetUserForm: "+err.Error(), Logger)
+		return forms.UserForm{}, err
+	}
+	return forms.UserForm{
+		ID:    strconv.FormatUint(uint64(p.UserID), 10),
+		Login: p.Login,
+	}, nil
 }
@@ -9,17 +9,24 @@ import (
 	"net/http"
 	"redditclone/pkg/errorsForProject"
 	"redditclone/pkg/forms"
+	"redditclone/pkg/jwtkeys"
+	"redditclone/pkg/ratelimit"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
+	"strconv"
 	"time"
 )
 
-var TokenSecret = []byte("my_secret_key")
-
 type UserHandler struct {
 	Logger         *zap.SugaredLogger
 	UserRepo       user.UsersRepo
 	SessionManager session.SessionRepo
+	RefreshTokens  session.RefreshRepo
+	Keys           *jwtkeys.KeySet
+	// TokenTTL - срок access-токена, дальше клиент обновляет его через /api/token/refresh
+	TokenTTL time.Duration
+	// Guard ограничивает перебор паролей и регистрацию, nil - без ограничений
+	Guard *ratelimit.Guard
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +36,18 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		JsonError(w, http.StatusBadRequest, "bad request", h.Logger)
 		return
 	}
+	if h.limited(w, r, "login", fd.Login) {
+		return
+	}
 	u, err := h.UserRepo.Authorize(fd.Login, fd.Password)
+	switch err {
+	case user.ErrNoUser, user.ErrBadPass:
+		// несуществующий логин тоже считаем, иначе по блокировке видно, какие логины заняты
+		h.loginFailed(r, fd.Login)
+	case nil, user.ErrUserDisabled:
+		// пароль верный
+		h.loginSucceeded(fd.Login)
+	}
 
 	if err == user.ErrNoUser {
 		resp, errMarshal := json.Marshal(map[string]interface{}{
@@ -58,6 +76,18 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		w.Write(resp)
 		return
 	}
+
+	if err == user.ErrUserDisabled {
+		w.WriteHeader(http.StatusForbidden)
+		sendMessage(w, "account disabled", h.Logger)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorw("can't authorize user", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't authorize user", h.Logger)
+		return
+	}
 	_, err = h.SessionManager.Create(w, u.ID, r.URL.Path)
 	if err != nil {
 		h.Logger.Infof("can't create session")
@@ -65,8 +95,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp := GetToken(w, *fd, fmt.Sprint(u.ID), h.Logger)
-	w.Write(resp)
+	h.sendTokens(w, u)
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -76,43 +105,254 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		JsonError(w, http.StatusBadRequest, "bad request", h.Logger)
 		return
 	}
+	if h.limited(w, r, "register", "") {
+		return
+	}
+	if errs := fd.Validate(); len(errs) > 0 {
+		SendValidationErrors(w, errs, h.Logger)
+		return
+	}
 	_, err = h.UserRepo.FindUser(fd.Login)
 
 	if err == nil {
-		resp, errMarshal := json.Marshal(map[string]interface{}{
-			"errors": []errorsForProject.RegisterError{{
-				Msg:      "already exists",
-				Location: "body",
-				Value:    fd.Login,
-				Param:    "username",
-			},
-			}})
-		if errMarshal != nil {
-			JsonError(w, http.StatusBadRequest, "Register: "+errorsForProject.ErrCantMarshal.Error(), h.Logger)
-			return
-		}
-
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write(resp)
+		h.userExists(w, fd.Login)
 		return
 	}
-	id := h.UserRepo.NewUserID()
-	h.UserRepo.Add(&user.User{
-		ID:       id,
+	u, err := h.UserRepo.Add(&user.User{
 		Login:    fd.Login,
 		Password: fd.Password,
 	})
-	h.UserRepo.FindUser(fd.Login)
+	if err == user.ErrUserExists {
+		// логин заняли между FindUser и Add
+		h.userExists(w, fd.Login)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorw("can't add user", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't add user", h.Logger)
+		return
+	}
 
-	_, err = h.SessionManager.Create(w, id, r.URL.Path)
+	_, err = h.SessionManager.Create(w, u.ID, r.URL.Path)
 	if err != nil {
 		h.Logger.Infof("can't create session")
 		JsonError(w, http.StatusBadRequest, "JsonError: "+"can't create session", h.Logger)
 		return
 	}
 
-	resp := GetToken(w, *fd, fmt.Sprint(id), h.Logger)
+	h.sendTokens(w, u)
+}
+
+// limited отвечает 429 с Retry-After, если попытки scope с этого адреса или для account исчерпаны
+func (h *UserHandler) limited(w http.ResponseWriter, r *http.Request, scope, account string) bool {
+	if h.Guard == nil {
+		return false
+	}
+	retry, err := h.Guard.Check(r, scope, account)
+	switch err {
+	case nil:
+		return false
+	case ratelimit.ErrLimited:
+		h.Logger.Warnw("too many attempts", "scope", scope, "account", account, "remote", r.RemoteAddr, "retry", retry)
+		// Retry-After в целых секундах, округляем вверх, чтобы клиент не пришел раньше
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((retry+time.Second-1)/time.Second), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+		JsonError(w, http.StatusTooManyRequests, "Login:"+err.Error(), h.Logger)
+		return true
+	default:
+		// хранилище ограничителя недоступно - пропускаем, вход без него все равно медленный из-за хеширования
+		h.Logger.Errorw("can't check rate limit", "scope", scope, "err", err)
+		return false
+	}
+}
+
+func (h *UserHandler) loginFailed(r *http.Request, login string) {
+	if h.Guard == nil || login == "" {
+		return
+	}
+	locked, err := h.Guard.Failed(login)
+	if err != nil {
+		h.Logger.Errorw("can't count failed login", "err", err)
+		return
+	}
+	if locked > 0 {
+		h.Logger.Warnw("account locked after failed logins", "account", login, "remote", r.RemoteAddr, "for", locked)
+	}
+}
+
+func (h *UserHandler) loginSucceeded(login string) {
+	if h.Guard == nil {
+		return
+	}
+	if err := h.Guard.Succeeded(login); err != nil {
+		h.Logger.Errorw("can't reset failed logins", "err", err)
+	}
+}
+
+// sendTokens начинает новую цепочку refresh-токенов и отдает ее первый токен вместе с access-токеном
+func (h *UserHandler) sendTokens(w http.ResponseWriter, u *user.User) {
+	refresh, err := h.RefreshTokens.IssueRefresh(u.ID, u.Login)
+	if err != nil {
+		h.Logger.Errorw("can't issue refresh token", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't issue refresh token", h.Logger)
+		return
+	}
+	resp := GetToken(w, u, refresh, h.Keys, h.TokenTTL, h.Logger)
+	w.Write(resp)
+}
+
+// Refresh меняет refresh-токен на новую пару. Каждый refresh-токен одноразовый:
+// повторное предъявление отзывает всю цепочку, и войти придется заново.
+// Роль берется из базы, поэтому ее смена доходит до клиента со следующим обновлением
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	fd := &forms.RefreshForm{}
+	err := json.NewDecoder(r.Body).Decode(&fd)
+	if err != nil || fd.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		JsonError(w, http.StatusBadRequest, "bad request", h.Logger)
+		return
+	}
+
+	refresh, rt, err := h.RefreshTokens.RotateRefresh(fd.Token)
+	switch err {
+	case nil:
+	case session.ErrNoRefresh, session.ErrRefreshExpired, session.ErrRefreshReused:
+		if err == session.ErrRefreshReused {
+			h.Logger.Warnw("refresh token reuse, token family revoked", "remote", r.RemoteAddr)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		JsonError(w, http.StatusUnauthorized, "Refresh:"+err.Error(), h.Logger)
+		return
+	default:
+		h.Logger.Errorw("can't rotate refresh token", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't rotate refresh token", h.Logger)
+		return
+	}
+
+	u, err := h.UserRepo.GetByID(rt.UserID)
+	if err == nil && u.Disabled {
+		err = user.ErrUserDisabled
+	}
+	switch err {
+	case nil:
+	case user.ErrNoUser, user.ErrUserDisabled:
+		// пользователя удалили или заблокировали в обход админки - цепочка больше не нужна
+		h.RefreshTokens.RevokeRefresh(refresh)
+		w.WriteHeader(http.StatusUnauthorized)
+		JsonError(w, http.StatusUnauthorized, "Refresh:"+err.Error(), h.Logger)
+		return
+	default:
+		h.Logger.Errorw("can't find user", "user", rt.UserID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't find user", h.Logger)
+		return
+	}
+
+	resp := GetToken(w, u, refresh, h.Keys, h.TokenTTL, h.Logger)
+	w.Write(resp)
+}
+
+// Logout завершает текущую сессию и цепочку refresh-токена из тела, если он передан.
+// Без сессии просто стираем куку - выход идемпотентен
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	fd := &forms.RefreshForm{}
+	// тело необязательно
+	json.NewDecoder(r.Body).Decode(&fd)
+	if fd.Token != "" {
+		if err := h.RefreshTokens.RevokeRefresh(fd.Token); err != nil {
+			h.Logger.Errorw("can't revoke refresh token", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			JsonError(w, http.StatusInternalServerError, "can't revoke refresh token", h.Logger)
+			return
+		}
+	}
+
+	sess, err := h.SessionManager.Check(r)
+	if err != nil {
+		session.ExpireCookie(w)
+		sendMessage(w, "logged out", h.Logger)
+		return
+	}
+
+	r = r.WithContext(session.ContextWithSession(r.Context(), sess))
+	if err = h.SessionManager.DestroyCurrent(w, r); err != nil {
+		h.Logger.Errorw("can't destroy session", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't destroy session", h.Logger)
+		return
+	}
+	sendMessage(w, "logged out", h.Logger)
+}
+
+// LogoutAll удаляет все сессии пользователя и отзывает все выпущенные ему токены, в том числе refresh
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	p, err := session.PrincipalFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		JsonError(w, http.StatusUnauthorized, "LogoutAll: "+err.Error(), h.Logger)
+		return
+	}
+
+	n, err := h.SessionManager.DestroyByUser(p.UserID)
+	if err == nil {
+		err = h.RefreshTokens.RevokeRefreshByUser(p.UserID)
+	}
+	if err == nil {
+		err = h.SessionManager.RevokeTokens(p.UserID, time.Now())
+	}
+	if err != nil {
+		h.Logger.Errorw("can't log out everywhere", "user", p.UserID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JsonError(w, http.StatusInternalServerError, "can't log out everywhere", h.Logger)
+		return
+	}
 
+	session.ExpireCookie(w)
+	resp, errMarshal := json.Marshal(map[string]interface{}{
+		"message":  "logged out everywhere",
+		"sessions": n,
+	})
+	if errMarshal != nil {
+		JsonError(w, http.StatusBadRequest, "LogoutAll: "+errorsForProject.ErrCantMarshal.Error(), h.Logger)
+		return
+	}
+	w.Write(resp)
+}
+
+func sendMessage(w http.ResponseWriter, msg string, Logger *zap.SugaredLogger) {
+	resp, errMarshal := json.Marshal(map[string]interface{}{
+		"message": msg,
+	})
+	if errMarshal != nil {
+		JsonError(w, http.StatusBadRequest, errorsForProject.ErrCantMarshal.Error(), Logger)
+		return
+	}
+	w.Write(resp)
+}
+
+func (h *UserHandler) userExists(w http.ResponseWriter, login string) {
+	SendValidationErrors(w, []errorsForProject.RegisterError{{
+		Msg:      "already exists",
+		Location: "body",
+		Value:    login,
+		Param:    "username",
+	}}, h.Logger)
+}
+
+// SendValidationErrors отвечает 422 со списком ошибок полей в формате, который рисует фронт
+func SendValidationErrors(w http.ResponseWriter, errs []errorsForProject.RegisterError, Logger *zap.SugaredLogger) {
+	resp, errMarshal := json.Marshal(map[string]interface{}{
+		"errors": errs,
+	})
+	if errMarshal != nil {
+		JsonError(w, http.StatusBadRequest, "Validation: "+errorsForProject.ErrCantMarshal.Error(), Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusUnprocessableEntity)
 	w.Write(resp)
 }
 
@@ -130,24 +370,32 @@ func JsonError(w io.Writer, status int, msg string, Logger *zap.SugaredLogger) {
 	w.Write(resp)
 }
 
-func GetToken(w http.ResponseWriter, fd forms.LoginForm, id string, Logger *zap.SugaredLogger) (resp []byte) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": jwt.MapClaims{
-			"username": fd.Login,
-			"id":       id,
-		},
-		"iat": time.Now().Local().Unix(),
-		"exp": time.Now().Add(24 * time.Hour).Local().Unix(),
+// GetToken подписывает access-токен. Роль и категории модератора едут в claims,
+// чтобы проверка прав не ходила в базу на каждый запрос
+func GetToken(w http.ResponseWriter, u *user.User, refresh string, keys *jwtkeys.KeySet, ttl time.Duration, Logger *zap.SugaredLogger) (resp []byte) {
+	userClaims := jwt.MapClaims{
+		"username": u.Login,
+		"id":       fmt.Sprint(u.ID),
+		"role":     u.Role,
+	}
+	if len(u.Categories) > 0 {
+		userClaims["categories"] = u.Categories
+	}
+	tokenString, err := keys.Sign(jwt.MapClaims{
+		"user": userClaims,
+		// iat дробный, с миллисекундами: по нему сверяется отзыв "выйти везде"
+		"iat": float64(time.Now().UnixMilli()) / 1000,
+		"exp": time.Now().Add(ttl).Local().Unix(),
 	})
-
-	tokenString, err := token.SignedString(TokenSecret)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	//fmt.Println("token ", tokenString)
 	resp, err = json.Marshal(map[string]interface{}{
-		"token": tokenString,
+		"token":         tokenString,
+		"refresh_token": refresh,
+		"expires_in":    int64(ttl / time.Second),
 	})
 	if err != nil {
 		JsonError(w, http.StatusBadRequest, "Get Token: "+errorsForProject.ErrCantMarshal.Error(), Logger)
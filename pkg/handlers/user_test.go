@@ -2,16 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"redditclone/pkg/jwtkeys"
+	"redditclone/pkg/ratelimit"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 	"strings"
 
 	"github.com/golang/mock/gomock"
-	"go.uber.org/zap"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestRegister(t *testing.T) {
@@ -25,8 +30,10 @@ func TestRegister(t *testing.T) {
 	ses := session.NewMockSessionRepo(ctrl)
 	service := &UserHandler{
 		UserRepo:       st,
-		Logger:         zap.NewNop().Sugar(), // не пишет логи
+		Logger:         nopLogger(),
 		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
 	}
 
 	resultUser := []*user.User{
@@ -35,11 +42,9 @@ func TestRegister(t *testing.T) {
 
 	// тут мы записываем последовтаельность вызовов и результат
 	st.EXPECT().FindUser(resultUser[0].Login).Return(nil, user.ErrNoUser)
-	st.EXPECT().NewUserID().Return(uint32(2))
-	st.EXPECT().Add(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}).Return(nil)
-	st.EXPECT().FindUser(resultUser[0].Login).Return(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}, nil)
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "qwe12345"}).Return(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}, nil)
 
-	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "12345678","username": "ayta"}`))
+	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "qwe12345","username": "ayta"}`))
 	w := httptest.NewRecorder()
 	ses.EXPECT().Create(w, uint32(2), "/api/register").Return(session.NewSession(uint32(2)), nil)
 	service.Register(w, req)
@@ -63,13 +68,15 @@ func TestBadRegister(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := user.NewMockUserRepo(ctrl)
-	st.EXPECT().Add(&user.User{ID: uint32(1), Login: "ayta", Password: "12345678"}).Return(nil)
-	st.Add(&user.User{ID: 1, Login: "ayta", Password: "12345678"})
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "qwe12345"}).Return(&user.User{ID: uint32(1), Login: "ayta", Password: "12345678"}, nil)
+	st.Add(&user.User{Login: "ayta", Password: "qwe12345"})
 	ses := session.NewMockSessionRepo(ctrl)
 	service := &UserHandler{
 		UserRepo:       st,
-		Logger:         zap.NewNop().Sugar(), // не пишет логи
+		Logger:         nopLogger(),
 		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
 	}
 
 	resultUser := []*user.User{
@@ -78,7 +85,7 @@ func TestBadRegister(t *testing.T) {
 
 	st.EXPECT().FindUser(resultUser[0].Login).Return(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}, nil)
 
-	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "12345678","username": "ayta"}`))
+	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "qwe12345","username": "ayta"}`))
 	w := httptest.NewRecorder()
 	service.Register(w, req)
 
@@ -95,15 +102,32 @@ func TestBadRegister(t *testing.T) {
 	w2 := httptest.NewRecorder()
 	service.Register(w2, req2)
 
-	req = httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "12345678","username": "ayta"}`))
+	req = httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "qwe12345","username": "ayta"}`))
 	w = httptest.NewRecorder()
 	st.EXPECT().FindUser("ayta").Return(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}, user.ErrNoUser)
 
-	st.EXPECT().NewUserID().Return(uint32(2))
-	st.EXPECT().Add(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}).Return(nil)
-	st.EXPECT().FindUser(resultUser[0].Login).Return(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}, nil)
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "qwe12345"}).Return(&user.User{ID: uint32(2), Login: "ayta", Password: "12345678"}, nil)
 	ses.EXPECT().Create(w, uint32(2), "/api/register").Return(nil, fmt.Errorf("no user"))
 	service.Register(w, req)
+
+	// логин заняли параллельным запросом
+	req = httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "qwe12345","username": "ayta"}`))
+	w = httptest.NewRecorder()
+	st.EXPECT().FindUser("ayta").Return(nil, user.ErrNoUser)
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "qwe12345"}).Return(nil, user.ErrUserExists)
+	service.Register(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "qwe12345","username": "ayta"}`))
+	w = httptest.NewRecorder()
+	st.EXPECT().FindUser("ayta").Return(nil, user.ErrNoUser)
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "qwe12345"}).Return(nil, fmt.Errorf("db is down"))
+	service.Register(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
 }
 
 func TestLogin(t *testing.T) {
@@ -114,13 +138,15 @@ func TestLogin(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := user.NewMockUserRepo(ctrl)
-	st.EXPECT().Add(&user.User{ID: uint32(1), Login: "ayta", Password: "12345678"}).Return(nil)
-	st.Add(&user.User{ID: 1, Login: "ayta", Password: "12345678"})
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "12345678"}).Return(&user.User{ID: uint32(1), Login: "ayta", Password: "12345678"}, nil)
+	st.Add(&user.User{Login: "ayta", Password: "12345678"})
 	ses := session.NewMockSessionRepo(ctrl)
 	service := &UserHandler{
 		UserRepo:       st,
-		Logger:         zap.NewNop().Sugar(), // не пишет логи
+		Logger:         nopLogger(),
 		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
 	}
 
 	resultUser := &user.User{ID: 1, Login: "ayta", Password: "12345678"}
@@ -144,6 +170,30 @@ func TestLogin(t *testing.T) {
 
 }
 
+func TestLoginDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	service := &UserHandler{
+		UserRepo:       st,
+		Logger:         nopLogger(),
+		SessionManager: session.NewMockSessionRepo(ctrl),
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
+	}
+
+	st.EXPECT().Authorize("ayta", "12345678").Return(nil, user.ErrUserDisabled)
+	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"password": "12345678","username": "ayta"}`))
+	w := httptest.NewRecorder()
+	service.Login(w, req)
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if w.Code != http.StatusForbidden || !bytes.Contains(body, []byte("account disabled")) {
+		t.Errorf("bad response: %d %s", w.Code, body)
+	}
+}
+
 func TestLoginNoUser(t *testing.T) {
 	// мы передаём t сюда, это надо чтобы получить корректное сообщение если тесты не пройдут
 	ctrl := gomock.NewController(t)
@@ -155,8 +205,10 @@ func TestLoginNoUser(t *testing.T) {
 	ses := session.NewMockSessionRepo(ctrl)
 	service := &UserHandler{
 		UserRepo:       st,
-		Logger:         zap.NewNop().Sugar(), // не пишет логи
+		Logger:         nopLogger(),
 		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
 	}
 
 	//resultUser := []*user.User{
@@ -190,14 +242,16 @@ func TestLoginBadPassword(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := user.NewMockUserRepo(ctrl)
-	st.EXPECT().Add(&user.User{ID: uint32(1), Login: "ayta", Password: "12345678"}).Return(nil)
-	st.Add(&user.User{ID: 1, Login: "ayta", Password: "12345678"})
+	st.EXPECT().Add(&user.User{Login: "ayta", Password: "12345678"}).Return(&user.User{ID: uint32(1), Login: "ayta", Password: "12345678"}, nil)
+	st.Add(&user.User{Login: "ayta", Password: "12345678"})
 
 	ses := session.NewMockSessionRepo(ctrl)
 	service := &UserHandler{
 		UserRepo:       st,
-		Logger:         zap.NewNop().Sugar(), // не пишет логи
+		Logger:         nopLogger(),
 		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
 	}
 
 	// тут мы записываем последовтаельность вызовов и результат
@@ -226,3 +280,240 @@ func TestLoginBadPassword(t *testing.T) {
 	ses.EXPECT().Create(w, uint32(2), "/api/login").Return(nil, fmt.Errorf("no user"))
 	service.Login(w, req)
 }
+
+func TestLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ses := session.NewMockSessionRepo(ctrl)
+	service := &UserHandler{
+		Logger:         nopLogger(),
+		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
+	}
+
+	sess := session.NewSession(uint32(2))
+	req := httptest.NewRequest("POST", "/api/logout", nil)
+	w := httptest.NewRecorder()
+	ses.EXPECT().Check(req).Return(sess, nil)
+	ses.EXPECT().DestroyCurrent(w, gomock.Any()).Return(nil)
+	service.Logout(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("bad status: %d", w.Code)
+	}
+
+	// без сессии выход тоже успешен, кука стирается
+	req = httptest.NewRequest("POST", "/api/logout", nil)
+	w = httptest.NewRecorder()
+	ses.EXPECT().Check(req).Return(nil, session.ErrNoAuth)
+	service.Logout(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("bad status: %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Expires.After(time.Now()) {
+		t.Errorf("cookie not expired: %v", cookies)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ses := session.NewMockSessionRepo(ctrl)
+	service := &UserHandler{
+		Logger:         nopLogger(),
+		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
+	}
+
+	req := httptest.NewRequest("POST", "/api/logout/all", nil)
+	req = withUser(req, 2, "ayta")
+	w := httptest.NewRecorder()
+	ses.EXPECT().DestroyByUser(uint32(2)).Return(int64(3), nil)
+	ses.EXPECT().RevokeTokens(uint32(2), gomock.Any()).Return(nil)
+	service.LogoutAll(w, req)
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if w.Code != http.StatusOK || !bytes.Contains(body, []byte(`"sessions":3`)) {
+		t.Errorf("bad response: %d %s", w.Code, body)
+	}
+
+	req = httptest.NewRequest("POST", "/api/logout/all", nil)
+	req = withUser(req, 2, "ayta")
+	w = httptest.NewRecorder()
+	ses.EXPECT().DestroyByUser(uint32(2)).Return(int64(0), fmt.Errorf("bad query"))
+	service.LogoutAll(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("bad status: %d", w.Code)
+	}
+}
+
+func testRefresh(t *testing.T) *session.SessionsInMemoryManager {
+	sm, err := session.NewSessionsInMemoryManager(session.Lifetime{Max: time.Hour, Refresh: 24 * time.Hour}, "")
+	if err != nil {
+		t.Fatalf("cant create sessions: %s", err)
+	}
+	return sm
+}
+
+func testKeys(t *testing.T) *jwtkeys.KeySet {
+	keys, err := jwtkeys.NewKeySet("", jwtkeys.NewHMAC("", []byte("test_secret")))
+	if err != nil {
+		t.Fatalf("cant create keys: %s", err)
+	}
+	return keys
+}
+
+func TestRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	refresh := testRefresh(t)
+	st := user.NewMockUserRepo(ctrl)
+	service := &UserHandler{
+		Logger:         nopLogger(),
+		UserRepo:       st,
+		SessionManager: session.NewMockSessionRepo(ctrl),
+		RefreshTokens:  refresh,
+		Keys:           testKeys(t),
+		TokenTTL:       time.Minute,
+	}
+
+	call := func(token string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(`{"refresh_token": "`+token+`"}`))
+		w := httptest.NewRecorder()
+		service.Refresh(w, req)
+		resp := map[string]interface{}{}
+		json.NewDecoder(w.Result().Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	first, err := refresh.IssueRefresh(2, "ayta")
+	if err != nil {
+		t.Fatalf("cant issue refresh: %s", err)
+	}
+	// роль берется из базы, а не из старого токена
+	st.EXPECT().GetByID(uint32(2)).Return(&user.User{ID: 2, Login: "ayta", Role: "moderator", Categories: []string{"music"}}, nil)
+	code, resp := call(first)
+	second, _ := resp["refresh_token"].(string)
+	if code != http.StatusOK || resp["token"] == nil || second == "" || second == first {
+		t.Fatalf("bad refresh response: %d %v", code, resp)
+	}
+	claims := jwt.MapClaims{}
+	if _, err = service.Keys.Parse(resp["token"].(string), claims); err != nil {
+		t.Fatalf("bad token: %s", err)
+	}
+	userClaims := claims["user"].(map[string]interface{})
+	if userClaims["role"] != "moderator" || fmt.Sprint(userClaims["categories"]) != "[music]" {
+		t.Errorf("bad role claims: %v", userClaims)
+	}
+	if resp["expires_in"] != float64(60) {
+		t.Errorf("bad expires_in: %v", resp["expires_in"])
+	}
+
+	// первый токен погашен: повторное предъявление отзывает всю цепочку, включая второй
+	code, _ = call(first)
+	if code != http.StatusUnauthorized {
+		t.Errorf("reused token accepted: %d", code)
+	}
+	code, _ = call(second)
+	if code != http.StatusUnauthorized {
+		t.Errorf("token from revoked family accepted: %d", code)
+	}
+
+	// заблокированному новый токен не выдаем
+	third, _ := refresh.IssueRefresh(2, "ayta")
+	st.EXPECT().GetByID(uint32(2)).Return(&user.User{ID: 2, Login: "ayta", Role: "user", Disabled: true}, nil)
+	code, _ = call(third)
+	if code != http.StatusUnauthorized {
+		t.Errorf("disabled user refreshed: %d", code)
+	}
+
+	code, _ = call("unknown")
+	if code != http.StatusUnauthorized {
+		t.Errorf("unknown token accepted: %d", code)
+	}
+	code, _ = call("")
+	if code != http.StatusBadRequest {
+		t.Errorf("empty token: %d", code)
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	ses := session.NewMockSessionRepo(ctrl)
+	service := &UserHandler{
+		UserRepo:       st,
+		Logger:         nopLogger(),
+		SessionManager: ses,
+		RefreshTokens:  testRefresh(t),
+		Keys:           testKeys(t),
+		Guard: ratelimit.NewGuard(ratelimit.NewMemoryStore(),
+			ratelimit.Rate{Burst: 100, Every: time.Second},
+			ratelimit.Rate{Burst: 100, Every: time.Second},
+			ratelimit.Lockout{Threshold: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour},
+			false,
+		),
+	}
+	loginTo := func(w *httptest.ResponseRecorder, pass string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"password": "`+pass+`","username": "ayta"}`))
+		service.Login(w, req)
+		return w
+	}
+	login := func(pass string) *httptest.ResponseRecorder {
+		return loginTo(httptest.NewRecorder(), pass)
+	}
+
+	// верный пароль сбрасывает счетчик неудач
+	st.EXPECT().Authorize("ayta", "bad").Return(nil, user.ErrBadPass)
+	login("bad")
+	st.EXPECT().Authorize("ayta", "12345678").Return(&user.User{ID: 1, Login: "ayta"}, nil)
+	ok := httptest.NewRecorder()
+	ses.EXPECT().Create(ok, uint32(1), "/api/login").Return(session.NewSession(1), nil)
+	if loginTo(ok, "12345678"); ok.Code != http.StatusOK {
+		t.Errorf("bad status: %d", ok.Code)
+	}
+
+	st.EXPECT().Authorize("ayta", "bad").Return(nil, user.ErrBadPass).Times(2)
+	login("bad")
+	if w := login("bad"); w.Code != http.StatusUnauthorized {
+		t.Errorf("bad status: %d", w.Code)
+	}
+	// аккаунт заблокирован - до проверки пароля не доходим, даже с верным
+	w := login("12345678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("bad response: %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRegisterRateLimit(t *testing.T) {
+	service := &UserHandler{
+		Logger: nopLogger(),
+		Guard: ratelimit.NewGuard(ratelimit.NewMemoryStore(),
+			ratelimit.Rate{Burst: 1, Every: time.Minute},
+			ratelimit.Rate{Burst: 1, Every: time.Minute},
+			ratelimit.Lockout{Threshold: 1, Base: time.Minute, Max: time.Minute, Window: time.Minute},
+			false,
+		),
+	}
+	register := func() *httptest.ResponseRecorder {
+		// форма невалидна, до хранилища не доходит
+		req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"password": "","username": ""}`))
+		w := httptest.NewRecorder()
+		service.Register(w, req)
+		return w
+	}
+
+	if w := register(); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bad status: %d", w.Code)
+	}
+	if w := register(); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("bad response: %d", w.Code)
+	}
+}
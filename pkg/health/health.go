@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check проверяет одну зависимость, ошибка означает что она недоступна
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Handler struct {
+	Logger  *zap.SugaredLogger
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+func NewHandler(timeout time.Duration, logger *zap.SugaredLogger) *Handler {
+	return &Handler{
+		Logger:  logger,
+		timeout: timeout,
+	}
+}
+
+func (h *Handler) Add(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+func SQLCheck(db *sql.DB) Check {
+	return db.PingContext
+}
+
+func MongoCheck(collection *mongo.Collection) Check {
+	return func(ctx context.Context) error {
+		return collection.Database().Client().Ping(ctx, nil)
+	}
+}
+
+// Live - процесс жив и обрабатывает запросы, зависимости не трогаем
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready опрашивает все зависимости параллельно, 503 если хоть одна недоступна
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	report := h.Run(ctx)
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+		h.Logger.Warnw("not ready", "checks", report.Checks)
+	}
+	writeReport(w, status, report)
+}
+
+func (h *Handler) Run(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(h.checks)),
+	}
+
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.check(ctx)
+			res := CheckResult{
+				Status:  StatusOK,
+				Latency: time.Since(start).String(),
+			}
+			if err != nil {
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[c.name] = res
+			if err != nil {
+				report.Status = StatusFail
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	resp, err := json.Marshal(report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
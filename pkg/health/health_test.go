@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestLive(t *testing.T) {
+	h := NewHandler(time.Second, zap.NewNop().Sugar())
+	h.Add("broken", func(ctx context.Context) error { return fmt.Errorf("down") })
+
+	w := httptest.NewRecorder()
+	h.Live(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestReady(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	h := NewHandler(time.Second, zap.NewNop().Sugar())
+	h.Add("mysql", SQLCheck(db))
+	h.Add("mongo", func(ctx context.Context) error { return nil })
+
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	assert.Equal(t, 200, w.Code)
+	report := Report{}
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	assert.NoError(t, json.Unmarshal(body, &report))
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["mysql"].Status)
+	assert.Equal(t, StatusOK, report.Checks["mongo"].Status)
+
+	// монга легла - инстанс не готов, но остальные проверки всё равно видны
+	h.checks[1].check = func(ctx context.Context) error { return fmt.Errorf("server selection timeout") }
+	w = httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	assert.Equal(t, 503, w.Code)
+	report = Report{}
+	body, _ = ioutil.ReadAll(w.Result().Body)
+	assert.NoError(t, json.Unmarshal(body, &report))
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["mysql"].Status)
+	assert.Equal(t, "server selection timeout", report.Checks["mongo"].Error)
+}
+
+func TestReadyTimeout(t *testing.T) {
+	h := NewHandler(10*time.Millisecond, zap.NewNop().Sugar())
+	h.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 503, w.Code)
+}
@@ -0,0 +1,92 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Generator выдает уникальные id новых объектов.
+// Pattern - регулярка для маршрутов mux, под которую подходят все выдаваемые id
+type Generator interface {
+	NextID() (string, error)
+	Pattern() string
+}
+
+const (
+	NumericPattern = "[0-9]+"
+	ULIDPattern    = "[0-9A-HJKMNP-TV-Z]{26}"
+)
+
+// Sequence - счетчик в памяти процесса, годится только вместе с in-memory хранилищем
+type Sequence struct {
+	mu   *sync.Mutex
+	last int64
+}
+
+func NewSequence(last int64) *Sequence {
+	return &Sequence{
+		mu:   &sync.Mutex{},
+		last: last,
+	}
+}
+
+func (s *Sequence) NextID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	return strconv.FormatInt(s.last, 10), nil
+}
+
+func (s *Sequence) Pattern() string {
+	return NumericPattern
+}
+
+// ULID - 48 бит времени в миллисекундах и 80 случайных бит в base32 Крокфорда.
+// Не требует общего состояния, id примерно упорядочены по времени создания
+type ULID struct {
+	now func() time.Time
+}
+
+func NewULID() *ULID {
+	return &ULID{now: time.Now}
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (u *ULID) NextID() (string, error) {
+	var data [16]byte
+	ms := uint64(u.now().UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		data[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := rand.Read(data[6:]); err != nil {
+		return "", err
+	}
+	return encodeULID(data), nil
+}
+
+func (u *ULID) Pattern() string {
+	return ULIDPattern
+}
+
+// encodeULID кодирует 128 бит в 26 символов, старшие биты первыми
+func encodeULID(data [16]byte) string {
+	out := make([]byte, 26)
+	// 130 бит вывода, первые два всегда нули
+	var acc uint64
+	bits := 2
+	pos := 0
+	for _, b := range data {
+		acc = acc<<8 | uint64(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = crockford[(acc>>uint(bits))&31]
+			pos++
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,115 @@
+package idgen
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// nextN параллельно берет n id и проверяет, что повторов нет
+func nextN(t *testing.T, gen Generator, n int) []string {
+	ids := make([]string, n)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := gen.NextID()
+			assert.NoError(t, err)
+			ids[i] = id
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, n)
+	re := regexp.MustCompile("^" + gen.Pattern() + "$")
+	for _, id := range ids {
+		assert.False(t, seen[id], "duplicate id %s", id)
+		assert.True(t, re.MatchString(id), "id %s does not match %s", id, gen.Pattern())
+		seen[id] = true
+	}
+	return ids
+}
+
+func TestSequence(t *testing.T) {
+	gen := NewSequence(41)
+	id, err := gen.NextID()
+	assert.NoError(t, err)
+	assert.Equal(t, "42", id)
+
+	nextN(t, gen, 100)
+	id, _ = gen.NextID()
+	assert.Equal(t, "143", id)
+}
+
+func TestULID(t *testing.T) {
+	ids := nextN(t, NewULID(), 100)
+	assert.Len(t, ids[0], 26)
+
+	// более поздний id больше лексикографически
+	gen := &ULID{now: func() time.Time { return time.Unix(1000, 0) }}
+	early, _ := gen.NextID()
+	gen.now = func() time.Time { return time.Unix(1000, int64(time.Millisecond)) }
+	late, _ := gen.NextID()
+	assert.True(t, early < late)
+	assert.True(t, sort.StringsAreSorted([]string{early, late}))
+}
+
+func TestEncodeULID(t *testing.T) {
+	var data [16]byte
+	assert.Equal(t, "00000000000000000000000000", encodeULID(data))
+	for i := range data {
+		data[i] = 0xff
+	}
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeULID(data))
+}
+
+// счетчик в монге проверяется только при доступном сервере
+func TestMongoCounter(t *testing.T) {
+	uri := os.Getenv("REDDITCLONE_TEST_MONGO_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err == nil {
+		err = client.Ping(ctx, nil)
+	}
+	if err != nil {
+		t.Skipf("mongo is not available: %s", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database("redditclone_idgen_test")
+	defer db.Drop(context.Background())
+
+	posts := db.Collection("posts")
+	_, err = posts.InsertMany(context.TODO(), []interface{}{
+		bson.M{"_id": "7"}, bson.M{"_id": "12"}, bson.M{"_id": "not-a-number"},
+	})
+	assert.NoError(t, err)
+
+	gen, err := NewMongoCounter(db.Collection("counters"), "posts", posts)
+	assert.NoError(t, err)
+	id, err := gen.NextID()
+	assert.NoError(t, err)
+	assert.Equal(t, "13", id)
+
+	nextN(t, gen, 50)
+
+	// повторная инициализация не откатывает счетчик назад
+	gen, err = NewMongoCounter(db.Collection("counters"), "posts", posts)
+	assert.NoError(t, err)
+	id, _ = gen.NextID()
+	assert.Equal(t, "64", id)
+}
@@ -0,0 +1,98 @@
+package idgen
+
+import (
+	"context"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCounter - счетчик в отдельной коллекции, документ {_id: name, seq: N}.
+// $inc атомарен, поэтому id не повторяются ни между запросами, ни между репликами сервиса
+type MongoCounter struct {
+	counters *mongo.Collection
+	name     string
+}
+
+type counterDoc struct {
+	Seq int64 `bson:"seq"`
+}
+
+// NewMongoCounter создает счетчик и поднимает его до максимального числового _id в seedFrom,
+// чтобы после перехода со старой схемы не выдавать уже занятые id. seedFrom может быть nil
+func NewMongoCounter(counters *mongo.Collection, name string, seedFrom *mongo.Collection) (*MongoCounter, error) {
+	c := &MongoCounter{
+		counters: counters,
+		name:     name,
+	}
+	if seedFrom == nil {
+		return c, nil
+	}
+
+	max, err := maxNumericID(seedFrom)
+	if err != nil {
+		return nil, err
+	}
+	_, err = counters.UpdateOne(context.TODO(),
+		bson.M{"_id": name},
+		bson.M{"$max": bson.M{"seq": max}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *MongoCounter) NextID() (string, error) {
+	doc := counterDoc{}
+	err := c.counters.FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": c.name},
+		bson.M{"$inc": bson.M{"seq": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(doc.Seq, 10), nil
+}
+
+func (c *MongoCounter) Pattern() string {
+	return NumericPattern
+}
+
+// maxNumericID ищет наибольший _id, который является числом, нечисловые id пропускаются
+func maxNumericID(collection *mongo.Collection) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{
+			"n": bson.M{"$convert": bson.M{
+				"input":   "$_id",
+				"to":      "long",
+				"onError": int64(0),
+				"onNull":  int64(0),
+			}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"max": bson.M{"$max": "$n"},
+		}}},
+	}
+	cur, err := collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(context.TODO())
+
+	res := struct {
+		Max int64 `bson:"max"`
+	}{}
+	if !cur.Next(context.TODO()) {
+		return 0, cur.Err()
+	}
+	if err = cur.Decode(&res); err != nil {
+		return 0, err
+	}
+	return res.Max, nil
+}
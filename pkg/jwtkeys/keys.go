@@ -0,0 +1,129 @@
+// Package jwtkeys хранит ключи подписи токенов: один подписывает, все остальные
+// еще принимаются при проверке, пока не истекут выпущенные ими токены
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnknownKey   = errors.New(" unknown signing key")
+	ErrNoSigningKey = errors.New(" no signing key")
+	ErrBadKey       = errors.New(" bad key")
+)
+
+// Key - ключ с идентификатором kid. Без закрытой части годится только для проверки
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private - чем подписывать, public - чем проверять. У HMAC это один и тот же секрет
+	private interface{}
+	public  interface{}
+}
+
+// CanSign - есть закрытая часть
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// NewHMAC - общий секрет HS256, как было до асимметричных ключей. В JWKS не публикуется
+func NewHMAC(kid string, secret []byte) *Key {
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// NewRSA - ключ RS256, priv может быть nil
+func NewRSA(kid string, priv *rsa.PrivateKey, pub *rsa.PublicKey) *Key {
+	k := &Key{ID: kid, Method: jwt.SigningMethodRS256, public: pub}
+	if priv != nil {
+		k.private = priv
+		k.public = &priv.PublicKey
+	}
+	return k
+}
+
+// NewEd25519 - ключ EdDSA, priv может быть nil
+func NewEd25519(kid string, priv ed25519.PrivateKey, pub ed25519.PublicKey) *Key {
+	k := &Key{ID: kid, Method: SigningMethodEdDSA, public: pub}
+	if priv != nil {
+		k.private = priv
+		k.public = priv.Public().(ed25519.PublicKey)
+	}
+	return k
+}
+
+// LoadFile читает ключ alg из PEM-файлов. Закрытый ключ - PKCS#8 (для RSA годится и PKCS#1),
+// открытый - PKIX. Если задан закрытый, открытый из него выводится и файл не нужен
+func LoadFile(kid, alg, privatePath, publicPath string) (*Key, error) {
+	var priv, pub interface{}
+	var err error
+	switch {
+	case privatePath != "":
+		priv, err = readPEM(privatePath, parsePrivate)
+	case publicPath != "":
+		pub, err = readPEM(publicPath, x509.ParsePKIXPublicKey)
+	default:
+		return nil, fmt.Errorf("jwtkeys: key %q: no key file", kid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: key %q: %w", kid, err)
+	}
+	if priv != nil {
+		pub = priv.(crypto.Signer).Public()
+	}
+
+	switch alg {
+	case AlgRS256:
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("jwtkeys: key %q is not RSA:%w", kid, ErrBadKey)
+		}
+		rsaPriv, _ := priv.(*rsa.PrivateKey)
+		return NewRSA(kid, rsaPriv, rsaPub), nil
+	case AlgEdDSA:
+		edPub, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("jwtkeys: key %q is not Ed25519:%w", kid, ErrBadKey)
+		}
+		edPriv, _ := priv.(ed25519.PrivateKey)
+		return NewEd25519(kid, edPriv, edPub), nil
+	}
+	return nil, fmt.Errorf("jwtkeys: key %q: unknown alg %q", kid, alg)
+}
+
+func readPEM(path string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block:%w", path, ErrBadKey)
+	}
+	key, err := parse(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v:%w", path, err, ErrBadKey)
+	}
+	return key, nil
+}
+
+func parsePrivate(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS1PrivateKey(der)
+}
@@ -0,0 +1,135 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeySet подписывает токены одним ключом и проверяет всеми.
+// Ротация: новый ключ добавляется и становится подписывающим, старый остается
+// только для проверки, пока не истекут его токены, потом удаляется из конфига
+type KeySet struct {
+	signer  *Key
+	keys    map[string]*Key
+	methods []string
+}
+
+// NewKeySet собирает набор. signKID пустой - подписывает первый ключ с закрытой частью
+func NewKeySet(signKID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	algs := map[string]bool{}
+	for _, k := range keys {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("jwtkeys: duplicate kid %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+		if !algs[k.Method.Alg()] {
+			algs[k.Method.Alg()] = true
+			ks.methods = append(ks.methods, k.Method.Alg())
+		}
+		if ks.signer == nil && k.CanSign() && (signKID == "" || signKID == k.ID) {
+			ks.signer = k
+		}
+	}
+	if ks.signer == nil {
+		return nil, fmt.Errorf("jwtkeys: kid %q:%w", signKID, ErrNoSigningKey)
+	}
+	return ks, nil
+}
+
+// SigningKID - каким ключом сейчас подписываем
+func (ks *KeySet) SigningKID() string {
+	return ks.signer.ID
+}
+
+// Sign подписывает claims текущим ключом и ставит его kid в заголовок
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signer.Method, claims)
+	if ks.signer.ID != "" {
+		token.Header["kid"] = ks.signer.ID
+	}
+	return token.SignedString(ks.signer.private)
+}
+
+// Parse проверяет подпись ключом из заголовка kid. Алгоритм должен совпадать с алгоритмом
+// этого ключа, иначе можно было бы подписать HS256 открытым RSA-ключом как секретом
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	parser := &jwt.Parser{ValidMethods: ks.methods}
+	return parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != k.Method.Alg() {
+			return nil, ErrBadKey
+		}
+		return k.public, nil
+	})
+}
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS - открытые ключи для проверки токенов другими сервисами. HMAC-секреты не публикуются
+func (ks *KeySet) JWKS() []JWK {
+	res := []JWK{}
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64(pub.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64(pub)
+		default:
+			continue
+		}
+		res = append(res, jwk)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Kid < res[j].Kid
+	})
+	return res
+}
+
+// ServeJWKS отдает /.well-known/jwks.json
+func (ks *KeySet) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(map[string]interface{}{
+		"keys": ks.JWKS(),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// ключи меняются только с рестартом, кешировать можно, но недолго - на время ротации
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(resp)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,135 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("cant write key: %s", err)
+	}
+	return path
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"user": jwt.MapClaims{"username": "ayta", "id": "2"},
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestLoadFileAndRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+
+	// старый RSA-ключ с закрытой частью в PKCS#1 - им выпущены токены до ротации
+	old, err := LoadFile("old", AlgRS256, writePEM(t, "old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), "")
+	assert.NoError(t, err)
+	oldSet, err := NewKeySet("", old)
+	assert.NoError(t, err)
+	oldToken, err := oldSet.Sign(testClaims())
+	assert.NoError(t, err)
+
+	// после ротации подписывает новый Ed25519, а от старого остался только открытый ключ
+	oldPub, err := LoadFile("old", AlgRS256, "", writePEM(t, "old.pub", "PUBLIC KEY", rsaPub))
+	assert.NoError(t, err)
+	assert.False(t, oldPub.CanSign())
+	fresh, err := LoadFile("new", AlgEdDSA, writePEM(t, "new.pem", "PRIVATE KEY", edDER), "")
+	assert.NoError(t, err)
+	ks, err := NewKeySet("new", oldPub, fresh)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", ks.SigningKID())
+
+	token, err := ks.Sign(testClaims())
+	assert.NoError(t, err)
+	parsed, err := ks.Parse(token, jwt.MapClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, AlgEdDSA, parsed.Method.Alg())
+
+	_, err = ks.Parse(oldToken, jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	// подпись другим Ed25519-ключом с тем же kid не проходит
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	forged, _ := NewKeySet("", NewEd25519("new", otherPriv, nil))
+	forgedToken, _ := forged.Sign(testClaims())
+	_, err = ks.Parse(forgedToken, jwt.MapClaims{})
+	assert.Error(t, err)
+
+	// ключ не того типа
+	_, err = LoadFile("bad", AlgRS256, writePEM(t, "bad.pem", "PRIVATE KEY", edDER), "")
+	assert.ErrorIs(t, err, ErrBadKey)
+	_, err = LoadFile("bad", AlgEdDSA, "", "")
+	assert.Error(t, err)
+
+	// закрытой части нет - подписывать нечем
+	_, err = NewKeySet("old", oldPub, fresh)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	// JWKS: только открытые ключи, без HMAC
+	ks, err = NewKeySet("new", oldPub, fresh, NewHMAC("", []byte("secret")))
+	assert.NoError(t, err)
+	jwks := ks.JWKS()
+	assert.Len(t, jwks, 2)
+	assert.Equal(t, "new", jwks[0].Kid)
+	assert.Equal(t, "OKP", jwks[0].Kty)
+	assert.Equal(t, b64(edPub), jwks[0].X)
+	assert.Equal(t, "RSA", jwks[1].Kty)
+	assert.Equal(t, "AQAB", jwks[1].E)
+
+	w := httptest.NewRecorder()
+	ks.ServeJWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	body := map[string][]JWK{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, jwks, body["keys"])
+}
+
+func TestParseRejects(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	ks, err := NewKeySet("", NewRSA("rsa", rsaKey, nil), NewHMAC("", []byte("secret")))
+	assert.NoError(t, err)
+
+	// открытый RSA-ключ подставлен как HMAC-секрет под kid RSA-ключа
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	confused.Header["kid"] = "rsa"
+	confusedToken, _ := confused.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPub}))
+	_, err = ks.Parse(confusedToken, jwt.MapClaims{})
+	assert.Error(t, err)
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	unknown.Header["kid"] = "missing"
+	unknownToken, _ := unknown.SignedString([]byte("secret"))
+	_, err = ks.Parse(unknownToken, jwt.MapClaims{})
+	assert.Error(t, err)
+
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = ks.Parse(none, jwt.MapClaims{})
+	assert.Error(t, err)
+
+	// старые токены без kid проверяются общим секретом
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("secret"))
+	_, err = ks.Parse(legacy, jwt.MapClaims{})
+	assert.NoError(t, err)
+}
@@ -1,32 +1,131 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"go.uber.org/zap"
+	"math"
 	"net/http"
+	"redditclone/pkg/authz"
 	"redditclone/pkg/handlers"
+	"redditclone/pkg/jwtkeys"
+	"redditclone/pkg/session"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func Auth(next http.HandlerFunc) http.HandlerFunc {
+var (
+	ErrNoToken      = errors.New(" no token")
+	ErrBadToken     = errors.New(" bad token")
+	ErrTokenRevoked = errors.New(" token revoked")
+	ErrNoSession    = errors.New(" no session")
+)
+
+// Authenticator проверяет токен и, если нужно, сессию, и кладет Principal в контекст запроса
+type Authenticator struct {
+	Keys *jwtkeys.KeySet
+	// Sessions нужен для проверки отзыва токенов и сверки сессии, nil - только токен
+	Sessions session.SessionRepo
+	// RequireSession - кроме токена нужна действующая сессия того же пользователя
+	RequireSession bool
+	Logger         *zap.SugaredLogger
+}
+
+func (a *Authenticator) Auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		zapLogger, err1 := zap.NewProduction()
-		if err1 != nil {
+		p, err := a.authenticate(r)
+		if err != nil {
+			a.Logger.Infow("auth failed", "url", r.URL.Path, "err", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			handlers.JsonError(w, http.StatusUnauthorized, "Auth:"+err.Error(), a.Logger)
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(session.ContextWithPrincipal(r.Context(), p)))
+	}
+}
 
-		defer zapLogger.Sync()
-		logger := zapLogger.Sugar()
-		tokenString := r.Header.Get("Authorization")
-		tokenString = tokenString[strings.Index(tokenString, " ")+1:]
-		claims := jwt.MapClaims{}
-		_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return handlers.TokenSecret, nil
-		})
-		if err != nil {
-			handlers.JsonError(w, http.StatusBadRequest, "Add: cant token parse", logger)
-			return
+func (a *Authenticator) authenticate(r *http.Request) (*session.Principal, error) {
+	header := r.Header.Get("Authorization")
+	tokenString := strings.TrimPrefix(header, "Bearer ")
+	if tokenString == "" || tokenString == header {
+		return nil, ErrNoToken
+	}
+	p, err := ParseToken(tokenString, a.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if a.Sessions == nil {
+		return p, nil
+	}
+
+	before, err := a.Sessions.TokensRevokedBefore(p.UserID)
+	if err != nil {
+		// хранилище недоступно - лучше не пустить, чем пустить отозванный токен
+		return nil, fmt.Errorf("%w: %v", ErrTokenRevoked, err)
+	}
+	// iat и граница отзыва с точностью до миллисекунды: отклоняем все, что выпущено
+	// не позже отзыва, а войти заново можно уже в следующую миллисекунду
+	if !before.IsZero() && !p.IssuedAt.After(before) {
+		return nil, ErrTokenRevoked
+	}
+
+	sess, err := a.Sessions.Check(r)
+	if err == nil && sess.UserID == p.UserID {
+		p.Session = sess
+	} else if a.RequireSession {
+		return nil, ErrNoSession
+	}
+	return p, nil
+}
+
+// ParseToken проверяет подпись ключом из kid (алгоритм закреплен за ключом, alg none не пройдет),
+// срок действия и достает пользователя из claims
+func ParseToken(tokenString string, keys *jwtkeys.KeySet) (*session.Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := keys.Parse(tokenString, claims)
+	if err != nil {
+		return nil, ErrBadToken
+	}
+	// Valid у MapClaims пропускает токены без exp, а бессрочные мы не выдаем
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrBadToken
+	}
+
+	userClaims, ok := claims["user"].(map[string]interface{})
+	if !ok {
+		return nil, ErrBadToken
+	}
+	userID, err := strconv.ParseUint(fmt.Sprint(userClaims["id"]), 10, 32)
+	if err != nil {
+		return nil, ErrBadToken
+	}
+	login, ok := userClaims["username"].(string)
+	if !ok || login == "" {
+		return nil, ErrBadToken
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, ErrBadToken
+	}
+
+	p := &session.Principal{
+		UserID:   uint32(userID),
+		Login:    login,
+		IssuedAt: time.UnixMilli(int64(math.Round(iat * 1000))),
+		Role:     authz.RoleUser,
+	}
+	// роль необязательна: в токенах, выпущенных до ролей, ее нет
+	if role, ok := userClaims["role"].(string); ok && role != "" {
+		p.Role = role
+	}
+	if categories, ok := userClaims["categories"].([]interface{}); ok {
+		for _, c := range categories {
+			if category, ok := c.(string); ok {
+				p.Categories = append(p.Categories, category)
+			}
 		}
-		next.ServeHTTP(w, r)
 	}
+	return p, nil
 }
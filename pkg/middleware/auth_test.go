@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/jwtkeys"
+	"redditclone/pkg/session"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testSecret = []byte("test_secret")
+
+func testKeys(t *testing.T) *jwtkeys.KeySet {
+	keys, err := jwtkeys.NewKeySet("", jwtkeys.NewHMAC("", testSecret))
+	if err != nil {
+		t.Fatalf("cant create keys: %s", err)
+	}
+	return keys
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("cant sign token: %s", err)
+	}
+	return token
+}
+
+func userClaims(id string, issued time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"user": jwt.MapClaims{"username": "ayta", "id": id},
+		"iat":  issued.Unix(),
+		"exp":  issued.Add(time.Hour).Unix(),
+	}
+}
+
+// call прогоняет запрос через middleware и возвращает код и пользователя, до которого дошел обработчик
+func call(a *Authenticator, token string, cookies ...*http.Cookie) (int, *session.Principal) {
+	var got *session.Principal
+	handler := a.Auth(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = session.PrincipalFromContext(r.Context())
+	})
+	req := httptest.NewRequest("POST", "/api/posts", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Code, got
+}
+
+func TestAuthToken(t *testing.T) {
+	a := &Authenticator{Keys: testKeys(t), Logger: zap.NewNop().Sugar()}
+	now := time.Now()
+
+	code, p := call(a, signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("2", now)))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint32(2), p.UserID)
+	assert.Equal(t, "ayta", p.Login)
+	assert.Equal(t, authz.RoleUser, p.Role)
+	assert.Nil(t, p.Session)
+
+	claims := userClaims("4", now)
+	claims["user"].(jwt.MapClaims)["role"] = authz.RoleModerator
+	claims["user"].(jwt.MapClaims)["categories"] = []string{"music", "news"}
+	code, p = call(a, signToken(t, jwt.SigningMethodHS256, testSecret, claims))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, authz.RoleModerator, p.Role)
+	assert.Equal(t, []string{"music", "news"}, p.Categories)
+
+	bad := []string{
+		"",
+		"garbage",
+		// протух
+		signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("2", now.Add(-2*time.Hour))),
+		// чужой секрет
+		signToken(t, jwt.SigningMethodHS256, []byte("other"), userClaims("2", now)),
+		// другой алгоритм с тем же секретом
+		signToken(t, jwt.SigningMethodHS512, testSecret, userClaims("2", now)),
+		// alg none
+		signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, userClaims("2", now)),
+		// без exp
+		signToken(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{
+			"user": jwt.MapClaims{"username": "ayta", "id": "2"},
+			"iat":  now.Unix(),
+		}),
+		// без пользователя
+		signToken(t, jwt.SigningMethodHS256, testSecret, jwt.MapClaims{"iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}),
+		signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("abc", now)),
+	}
+	for i, token := range bad {
+		code, p = call(a, token)
+		assert.Equal(t, http.StatusUnauthorized, code, "case %d", i)
+		assert.Nil(t, p, "case %d", i)
+	}
+}
+
+func TestAuthRevokedToken(t *testing.T) {
+	sessions, err := session.NewSessionsInMemoryManager(session.Lifetime{Max: time.Hour}, "")
+	assert.NoError(t, err)
+	a := &Authenticator{Keys: testKeys(t), Sessions: sessions, Logger: zap.NewNop().Sugar()}
+
+	issued := time.Now().Add(-time.Minute)
+	token := signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("2", issued))
+	code, _ := call(a, token)
+	assert.Equal(t, http.StatusOK, code)
+
+	// токен выпущен до "выйти везде"
+	assert.NoError(t, sessions.RevokeTokens(2, time.Now()))
+	code, _ = call(a, token)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// в пределах одной секунды: выпущенный до отзыва или в ту же миллисекунду отклоняется,
+	// выпущенный после - действует. iat у старых токенов целый, он тоже не позже отзыва
+	revoked := time.Date(2022, 5, 10, 12, 0, 0, 400*int(time.Millisecond), time.UTC)
+	assert.NoError(t, sessions.RevokeTokens(3, revoked))
+	for _, c := range []struct {
+		iat  interface{}
+		code int
+	}{
+		{revoked.Unix(), http.StatusUnauthorized},
+		{float64(revoked.UnixMilli()-100) / 1000, http.StatusUnauthorized},
+		{float64(revoked.UnixMilli()) / 1000, http.StatusUnauthorized},
+		{float64(revoked.UnixMilli()+1) / 1000, http.StatusOK},
+	} {
+		claims := userClaims("3", revoked)
+		claims["iat"] = c.iat
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		code, _ = call(a, signToken(t, jwt.SigningMethodHS256, testSecret, claims))
+		assert.Equal(t, c.code, code, "iat %v", c.iat)
+	}
+}
+
+func TestAuthSession(t *testing.T) {
+	sessions, err := session.NewSessionsInMemoryManager(session.Lifetime{Max: time.Hour}, "")
+	assert.NoError(t, err)
+	a := &Authenticator{Keys: testKeys(t), Sessions: sessions, Logger: zap.NewNop().Sugar()}
+
+	w := httptest.NewRecorder()
+	sess, err := sessions.Create(w, 2, "/api/login")
+	assert.NoError(t, err)
+	cookie := w.Result().Cookies()[0]
+	token := signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("2", time.Now()))
+	stranger := signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("3", time.Now()))
+
+	// сессия необязательна, но если она есть и своя - попадает в контекст
+	code, p := call(a, token, cookie)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, sess.ID, p.Session.ID)
+	code, p = call(a, stranger, cookie)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, p.Session)
+
+	a.RequireSession = true
+	code, _ = call(a, token)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = call(a, stranger, cookie)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = call(a, token, cookie)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRequireRole(t *testing.T) {
+	a := &Authenticator{Keys: testKeys(t), Logger: zap.NewNop().Sugar()}
+	reached := false
+	handler := a.RequireRole(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}, authz.RoleAdmin)
+	roleCall := func(token string) int {
+		reached = false
+		req := httptest.NewRequest("GET", "/api/admin/users", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, roleCall(""))
+	assert.Equal(t, http.StatusForbidden, roleCall(signToken(t, jwt.SigningMethodHS256, testSecret, userClaims("2", time.Now()))))
+	assert.False(t, reached)
+
+	claims := userClaims("1", time.Now())
+	claims["user"].(jwt.MapClaims)["role"] = authz.RoleAdmin
+	assert.Equal(t, http.StatusOK, roleCall(signToken(t, jwt.SigningMethodHS256, testSecret, claims)))
+	assert.True(t, reached)
+}
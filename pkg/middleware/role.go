@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/handlers"
+	"redditclone/pkg/session"
+)
+
+// RequireRole - то же, что Auth, но пропускает только пользователей с одной из ролей:
+// без токена 401, с чужой ролью 403. Роль берется из токена
+func (a *Authenticator) RequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return a.Auth(func(w http.ResponseWriter, r *http.Request) {
+		p, err := session.PrincipalFromContext(r.Context())
+		if err == nil {
+			err = authz.HasRole(p, roles...)
+		}
+		if err != nil {
+			a.Logger.Infow("role required", "url", r.URL.Path, "roles", roles, "err", err)
+			w.WriteHeader(http.StatusForbidden)
+			handlers.JsonError(w, http.StatusForbidden, "Auth:"+err.Error(), a.Logger)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
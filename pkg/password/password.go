@@ -0,0 +1,194 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrBadHash = errors.New(" Malformed password hash")
+)
+
+// алгоритмы, которые можно выбрать в конфиге
+const (
+	AlgoBcrypt   = "bcrypt"
+	AlgoArgon2id = "argon2id"
+)
+
+// Hasher хеширует новые пароли текущим алгоритмом и проверяет хеши всех поддерживаемых форматов,
+// включая старые пароли открытым текстом
+type Hasher interface {
+	Hash(pass string) (string, error)
+	// Verify сравнивает пароль с сохраненным значением.
+	// needsRehash - пароль верный, но сохранен открытым текстом, другим алгоритмом или с другими параметрами
+	Verify(encoded, pass string) (ok bool, needsRehash bool, err error)
+}
+
+// New выбирает алгоритм по имени из конфига
+func New(algo string, bcryptCost int) (Hasher, error) {
+	switch algo {
+	case AlgoBcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be in [%d, %d]", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return NewBcrypt(bcryptCost), nil
+	case AlgoArgon2id:
+		return NewArgon2id(DefaultArgon2Params), nil
+	}
+	return nil, fmt.Errorf("unknown password hash %q", algo)
+}
+
+// Bcrypt
+
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{cost: cost}
+}
+
+func (h *Bcrypt) Hash(pass string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *Bcrypt) Verify(encoded, pass string) (bool, bool, error) {
+	ok, err := verify(encoded, pass)
+	if !ok || err != nil {
+		return ok, false, err
+	}
+	if !isBcrypt(encoded) {
+		return true, true, nil
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return true, err != nil || cost != h.cost, nil
+}
+
+// Argon2id
+
+// Argon2Params - параметры argon2id, Memory в KiB
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2Params - рекомендации RFC 9106 для ограниченной памяти
+var DefaultArgon2Params = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+type Argon2id struct {
+	params Argon2Params
+}
+
+func NewArgon2id(params Argon2Params) *Argon2id {
+	return &Argon2id{params: params}
+}
+
+// Hash возвращает строку в формате PHC: $argon2id$v=19$m=65536,t=3,p=4$соль$хеш
+func (h *Argon2id) Hash(pass string) (string, error) {
+	salt := make([]byte, h.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(pass), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2id) Verify(encoded, pass string) (bool, bool, error) {
+	ok, err := verify(encoded, pass)
+	if !ok || err != nil {
+		return ok, false, err
+	}
+	if !isArgon2id(encoded) {
+		return true, true, nil
+	}
+	p, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return true, true, nil
+	}
+	same := p.Time == h.params.Time && p.Memory == h.params.Memory && p.Threads == h.params.Threads &&
+		uint32(len(salt)) == h.params.SaltLen && uint32(len(key)) == h.params.KeyLen
+	return true, !same, nil
+}
+
+// ОБЩЕЕ
+
+// verify определяет формат по префиксу и проверяет пароль
+func verify(encoded, pass string) (bool, error) {
+	switch {
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(pass))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	case isArgon2id(encoded):
+		p, salt, key, err := parseArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(pass), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+	// старая запись открытым текстом
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(pass)) == 1, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func isArgon2id(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func parseArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	p := Argon2Params{}
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", соль, хеш
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrBadHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrBadHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrBadHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrBadHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrBadHash
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+	return p, salt, key, nil
+}
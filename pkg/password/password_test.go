@@ -0,0 +1,90 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// дешевые параметры, чтобы тесты шли быстро
+var testArgon2Params = Argon2Params{Time: 1, Memory: 1024, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestBcrypt(t *testing.T) {
+	h := NewBcrypt(4)
+	hash, err := h.Hash("12345678")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"))
+
+	ok, rehash, err := h.Verify(hash, "12345678")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = h.Verify(hash, "1234567")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// стоимость подняли - старый хеш нужно пересчитать
+	ok, rehash, _ = NewBcrypt(5).Verify(hash, "12345678")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestArgon2id(t *testing.T) {
+	h := NewArgon2id(testArgon2Params)
+	hash, err := h.Hash("12345678")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	other, _ := h.Hash("12345678")
+	assert.NotEqual(t, hash, other, "salt must differ")
+
+	ok, rehash, err := h.Verify(hash, "12345678")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, _ = h.Verify(hash, "1234567")
+	assert.False(t, ok)
+
+	params := testArgon2Params
+	params.Time = 2
+	ok, rehash, _ = NewArgon2id(params).Verify(hash, "12345678")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	_, _, err = h.Verify("$argon2id$v=19$m=1024$bad", "12345678")
+	assert.Equal(t, ErrBadHash, err)
+}
+
+func TestLegacyAndCrossAlgo(t *testing.T) {
+	bc := NewBcrypt(4)
+	ar := NewArgon2id(testArgon2Params)
+
+	// пароль открытым текстом: проверяется, но требует перехеширования
+	ok, rehash, err := bc.Verify("12345678", "12345678")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	ok, rehash, _ = ar.Verify("12345678", "1234567")
+	assert.False(t, ok)
+	assert.False(t, rehash)
+
+	// смена алгоритма: старые хеши продолжают работать и переводятся на новый
+	hash, _ := bc.Hash("12345678")
+	ok, rehash, _ = ar.Verify(hash, "12345678")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(AlgoBcrypt, 12)
+	assert.NoError(t, err)
+	_, err = New(AlgoArgon2id, 0)
+	assert.NoError(t, err)
+	_, err = New(AlgoBcrypt, 100)
+	assert.Error(t, err)
+	_, err = New("md5", 0)
+	assert.Error(t, err)
+}
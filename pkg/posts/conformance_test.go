@@ -0,0 +1,49 @@
+package posts_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/posts/repotest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestInMemoryConformance(t *testing.T) {
+	repotest.RunPostRepoSuite(t, func(t *testing.T) posts.PostRepo {
+		return posts.NewInMemoryRepo()
+	})
+}
+
+// для запуска нужен mongod: docker-compose -f assets/docker-compose.yml up mongodb
+// адрес можно поменять через REDDITCLONE_TEST_MONGO_URI
+func TestMongoConformance(t *testing.T) {
+	uri := os.Getenv("REDDITCLONE_TEST_MONGO_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(time.Second))
+	if err == nil {
+		err = client.Ping(ctx, nil)
+	}
+	if err != nil {
+		t.Skipf("mongo is not available at %s: %s", uri, err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database("redditclone_test")
+	n := 0
+	repotest.RunPostRepoSuite(t, func(t *testing.T) posts.PostRepo {
+		n++
+		collection := db.Collection(fmt.Sprintf("posts_%d_%d", time.Now().UnixNano(), n))
+		t.Cleanup(func() { collection.Drop(context.Background()) })
+		return posts.NewMemoryRepo(collection)
+	})
+}
@@ -0,0 +1,221 @@
+package posts
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"redditclone/pkg/ranking"
+	"time"
+)
+
+var ErrBadCursor = errors.New(" bad cursor")
+
+// FeedQuery - какие посты отдавать в ленту и в каком порядке
+type FeedQuery struct {
+	// Category и Author (логин автора) сужают ленту, пустые - без фильтра
+	Category string
+	Author   string
+	// Sort - имя стратегии из ranking, пусто - ranking.DefaultSort
+	Sort string
+	// Window - только посты за последний период (?t=), 0 - за все время
+	Window time.Duration
+	// Limit - сколько постов вернуть, 0 - все
+	Limit int
+	// Now - от него считается возраст постов, нулевое - текущее время
+	Now time.Time
+	// After - страница ниже курсора, Before - выше. Задается не больше одного
+	After  *Cursor
+	Before *Cursor
+}
+
+// FeedPage - страница ленты и курсоры соседних страниц, nil - в ту сторону постов нет
+type FeedPage struct {
+	Posts []*Post
+	Next  *Cursor
+	Prev  *Cursor
+}
+
+// Cursor - место в ленте: ключ сортировки граничного поста страницы. Помнит сортировку и
+// момент расчета рангов, чтобы ранги rising не менялись, пока ленту листают
+type Cursor struct {
+	Sort      string        `json:"s"`
+	Window    time.Duration `json:"w,omitempty"`
+	Now       time.Time     `json:"n"`
+	Rank      float64       `json:"r"`
+	CreatedAt time.Time     `json:"c"`
+	ID        string        `json:"i"`
+}
+
+// Encode - непрозрачная строка для ?after= и ?before=
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+	c := &Cursor{}
+	if err = json.Unmarshal(data, c); err != nil || c.ID == "" {
+		return nil, ErrBadCursor
+	}
+	return c, nil
+}
+
+// feedPlan - разобранный запрос
+type feedPlan struct {
+	strategy ranking.Strategy
+	sort     string
+	// now - момент расчета рангов, since - самый ранний допустимый пост
+	now   time.Time
+	since time.Time
+	// cursor - граница страницы, reverse - страница выше нее
+	cursor  *Cursor
+	reverse bool
+}
+
+// plan разбирает запрос. Курсор подходит только к той сортировке и окну, для которых выдан
+func (q FeedQuery) plan() (*feedPlan, error) {
+	p := &feedPlan{sort: q.Sort}
+	if p.sort == "" {
+		p.sort = ranking.DefaultSort
+	}
+	strategy, err := ranking.Get(p.sort)
+	if err != nil {
+		return nil, err
+	}
+	p.strategy = strategy
+
+	p.cursor, p.reverse = q.After, false
+	if q.Before != nil {
+		if q.After != nil {
+			return nil, fmt.Errorf("%w: both after and before", ErrBadCursor)
+		}
+		p.cursor, p.reverse = q.Before, true
+	}
+
+	p.now = q.Now
+	if p.cursor != nil {
+		if p.cursor.Sort != p.sort || p.cursor.Window != q.Window {
+			return nil, fmt.Errorf("%w: issued for another sort", ErrBadCursor)
+		}
+		p.now = p.cursor.Now
+	}
+	if p.now.IsZero() {
+		p.now = time.Now()
+	}
+
+	window := q.Window
+	if maxAge := strategy.MaxAge(); maxAge > 0 && (window == 0 || maxAge < window) {
+		window = maxAge
+	}
+	if window > 0 {
+		p.since = p.now.Add(-window)
+	}
+	return p, nil
+}
+
+// match - подходит ли пост под фильтры запроса. Удаленные в ленты не попадают
+func (q FeedQuery) match(post *Post, since time.Time) bool {
+	if post.Deleted() {
+		return false
+	}
+	if q.Category != "" && post.Category != q.Category {
+		return false
+	}
+	if q.Author != "" && post.CreatedBy.Login != q.Author {
+		return false
+	}
+	return since.IsZero() || !post.CreatedAt.Before(since)
+}
+
+// entry - пост с ключом сортировки: ранг, дата создания, id - все по убыванию
+type entry struct {
+	post    *Post
+	rank    float64
+	created time.Time
+}
+
+func (e entry) key() *Cursor {
+	return &Cursor{Rank: e.rank, CreatedAt: e.created, ID: e.post.ID}
+}
+
+// cmp - положение поста относительно позиции c: 1 - выше в ленте, -1 - ниже, 0 - на ней
+func (e entry) cmp(c *Cursor) int {
+	switch {
+	case e.rank != c.Rank:
+		return sign(e.rank > c.Rank)
+	case !e.created.Equal(c.CreatedAt):
+		return sign(e.created.After(c.CreatedAt))
+	case e.post.ID != c.ID:
+		return sign(e.post.ID > c.ID)
+	}
+	return 0
+}
+
+// direction - знак cmp для постов, которые идут за курсором в сторону запроса
+func (p *feedPlan) direction() int {
+	if p.reverse {
+		return 1
+	}
+	return -1
+}
+
+func sign(above bool) int {
+	if above {
+		return 1
+	}
+	return -1
+}
+
+// page собирает страницу из постов, отобранных от курсора в сторону запроса,
+// с запасом в один пост, по которому видно, есть ли следующая страница
+func (q FeedQuery) page(p *feedPlan, found []entry) *FeedPage {
+	more := q.Limit > 0 && len(found) > q.Limit
+	if more {
+		found = found[:q.Limit]
+	}
+	if p.reverse {
+		for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+			found[i], found[j] = found[j], found[i]
+		}
+	}
+
+	page := &FeedPage{Posts: make([]*Post, 0, len(found))}
+	for _, e := range found {
+		page.Posts = append(page.Posts, e.post)
+	}
+	if len(found) == 0 {
+		return page
+	}
+	cursor := func(e entry) *Cursor {
+		c := e.key()
+		c.Sort, c.Window, c.Now = p.sort, q.Window, p.now
+		return c
+	}
+	first, last := found[0], found[len(found)-1]
+	// со стороны, откуда пришел курсор, посты точно есть
+	if p.reverse || more {
+		page.Next = cursor(last)
+	}
+	if p.reverse && more || !p.reverse && p.cursor != nil {
+		page.Prev = cursor(first)
+	}
+	return page
+}
+
+func stats(post *Post) ranking.Stats {
+	s := ranking.Stats{Score: post.Score, CreatedAt: post.CreatedAt}
+	for _, vote := range post.Votes {
+		switch vote.Vote {
+		case 1:
+			s.Ups++
+		case -1:
+			s.Downs++
+		}
+	}
+	return s
+}
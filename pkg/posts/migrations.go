@@ -0,0 +1,77 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// EnsureIndexes создает индексы под фильтры и сортировки ленты, существующие не трогает
+func (repo *PostMemoryRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := repo.data.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// new и top сортируются по сохраненным полям, эти индексы покрывают их ключи
+		{Keys: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "score", Value: -1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "score", Value: -1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "author.login", Value: 1}, {Key: "createdAt", Value: -1}}},
+		// для очистки удаленных, живых постов в индексе нет
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("create post indexes: %w", err)
+	}
+	return nil
+}
+
+// BackfillCreated переводит посты со строковой датой created ("2") на createdAt датой
+// и проставляет даты их комментариям. Повторный запуск ничего не меняет.
+// Настоящее время создания старых постов неизвестно, поэтому им достается дата
+// самого раннего поста с датой, а если таких нет - время миграции
+func (repo *PostMemoryRepository) BackfillCreated(ctx context.Context) (int64, error) {
+	fallback := time.Now().UTC().Truncate(time.Millisecond)
+	oldest := &Post{}
+	err := repo.data.FindOne(ctx,
+		bson.M{"createdAt": bson.M{"$type": "date"}},
+		options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetProjection(bson.M{"createdAt": 1}),
+	).Decode(oldest)
+	switch {
+	case err == nil:
+		fallback = oldest.CreatedAt
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return 0, fmt.Errorf("backfill created: %w", err)
+	}
+
+	isDate := func(field string) bson.M {
+		return bson.M{"$eq": bson.A{bson.M{"$type": field}, "date"}}
+	}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"createdAt": bson.M{"$not": bson.M{"$type": "date"}}},
+		bson.M{"created": bson.M{"$exists": true}},
+		bson.M{"comments.currenttime": bson.M{"$exists": true}},
+	}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"createdAt": bson.M{"$cond": bson.A{isDate("$createdAt"), "$createdAt", fallback}},
+		}}},
+		// комментарий без даты не старше своего поста
+		{{Key: "$set", Value: bson.M{
+			"comments": bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$comments", bson.A{}}},
+				"in": bson.M{"$mergeObjects": bson.A{"$$this", bson.M{
+					"createdat": bson.M{"$cond": bson.A{isDate("$$this.createdat"), "$$this.createdat", "$createdAt"}},
+				}}},
+			}},
+		}}},
+		{{Key: "$unset", Value: bson.A{"created", "comments.currenttime"}}},
+	}
+	res, err := repo.data.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("backfill created: %w", err)
+	}
+	return res.ModifiedCount, nil
+}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	comments "redditclone/pkg/comments"
+
 	forms "redditclone/pkg/forms"
 
 	mock "github.com/stretchr/testify/mock"
@@ -10,6 +12,8 @@ import (
 	posts "redditclone/pkg/posts"
 
 	testing "testing"
+
+	time "time"
 )
 
 // PostRepo is an autogenerated mock type for the PostRepo type
@@ -31,6 +35,75 @@ func (_m *PostRepo) Add(post *posts.Post) error {
 	return r0
 }
 
+// AddComment provides a mock function with given fields: postID, c
+func (_m *PostRepo) AddComment(postID string, c *comments.Comment) (*posts.Post, error) {
+	ret := _m.Called(postID, c)
+
+	var r0 *posts.Post
+	if rf, ok := ret.Get(0).(func(string, *comments.Comment) *posts.Post); ok {
+		r0 = rf(postID, c)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*posts.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *comments.Comment) error); ok {
+		r1 = rf(postID, c)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddView provides a mock function with given fields: postID
+func (_m *PostRepo) AddView(postID string) (*posts.Post, error) {
+	ret := _m.Called(postID)
+
+	var r0 *posts.Post
+	if rf, ok := ret.Get(0).(func(string) *posts.Post); ok {
+		r0 = rf(postID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*posts.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(postID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ApplyVote provides a mock function with given fields: postID, userID, value
+func (_m *PostRepo) ApplyVote(postID string, userID string, value int) (*posts.Post, error) {
+	ret := _m.Called(postID, userID, value)
+
+	var r0 *posts.Post
+	if rf, ok := ret.Get(0).(func(string, string, int) *posts.Post); ok {
+		r0 = rf(postID, userID, value)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*posts.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, int) error); ok {
+		r1 = rf(postID, userID, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DecreaseVote provides a mock function with given fields: fd, post
 func (_m *PostRepo) DecreaseVote(fd *forms.VoteForm, post *posts.Post) *posts.Post {
 	ret := _m.Called(fd, post)
@@ -61,6 +134,52 @@ func (_m *PostRepo) Delete(id string) bool {
 	return r0
 }
 
+// Feed provides a mock function with given fields: q
+func (_m *PostRepo) Feed(q posts.FeedQuery) ([]*posts.Post, error) {
+	ret := _m.Called(q)
+
+	var r0 []*posts.Post
+	if rf, ok := ret.Get(0).(func(posts.FeedQuery) []*posts.Post); ok {
+		r0 = rf(q)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*posts.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(posts.FeedQuery) error); ok {
+		r1 = rf(q)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FeedPage provides a mock function with given fields: q
+func (_m *PostRepo) FeedPage(q posts.FeedQuery) (*posts.FeedPage, error) {
+	ret := _m.Called(q)
+
+	var r0 *posts.FeedPage
+	if rf, ok := ret.Get(0).(func(posts.FeedQuery) *posts.FeedPage); ok {
+		r0 = rf(q)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*posts.FeedPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(posts.FeedQuery) error); ok {
+		r1 = rf(q)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetAll provides a mock function with given fields:
 func (_m *PostRepo) GetAll() ([]*posts.Post, error) {
 	ret := _m.Called()
@@ -107,20 +226,6 @@ func (_m *PostRepo) GetByID(id string) (*posts.Post, error) {
 	return r0, r1
 }
 
-// GetLastId provides a mock function with given fields:
-func (_m *PostRepo) GetLastId() int {
-	ret := _m.Called()
-
-	var r0 int
-	if rf, ok := ret.Get(0).(func() int); ok {
-		r0 = rf()
-	} else {
-		r0 = ret.Get(0).(int)
-	}
-
-	return r0
-}
-
 // GetPostsByUser provides a mock function with given fields: author
 func (_m *PostRepo) GetPostsByUser(author forms.UserForm) ([]*posts.Post, error) {
 	ret := _m.Called(author)
@@ -188,13 +293,73 @@ func (_m *PostRepo) IncreaseVote(fd *forms.VoteForm, post *posts.Post) *posts.Po
 	return r0
 }
 
-// Update provides a mock function with given fields: post
-func (_m *PostRepo) Update(post *posts.Post) (*posts.Post, error) {
-	ret := _m.Called(post)
+// PurgeDeleted provides a mock function with given fields: before
+func (_m *PostRepo) PurgeDeleted(before time.Time) ([]string, int64, error) {
+	ret := _m.Called(before)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(time.Time) []string); ok {
+		r0 = rf(before)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 int64
+	if rf, ok := ret.Get(1).(func(time.Time) int64); ok {
+		r1 = rf(before)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(time.Time) error); ok {
+		r2 = rf(before)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// SetCommentDeletion provides a mock function with given fields: postID, commentID, at, by, reason
+func (_m *PostRepo) SetCommentDeletion(postID string, commentID string, at *time.Time, by *forms.UserForm, reason string) (*posts.Post, error) {
+	ret := _m.Called(postID, commentID, at, by, reason)
 
 	var r0 *posts.Post
-	if rf, ok := ret.Get(0).(func(*posts.Post) *posts.Post); ok {
-		r0 = rf(post)
+	if rf, ok := ret.Get(0).(func(string, string, *time.Time, *forms.UserForm, string) *posts.Post); ok {
+		r0 = rf(postID, commentID, at, by, reason)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*posts.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *time.Time, *forms.UserForm, string) error); ok {
+		r1 = rf(postID, commentID, at, by, reason)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Update provides a mock function with given fields: post, fields
+func (_m *PostRepo) Update(post *posts.Post, fields ...string) (*posts.Post, error) {
+	_va := make([]interface{}, len(fields))
+	for _i := range fields {
+		_va[_i] = fields[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, post)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *posts.Post
+	if rf, ok := ret.Get(0).(func(*posts.Post, ...string) *posts.Post); ok {
+		r0 = rf(post, fields...)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*posts.Post)
@@ -202,8 +367,8 @@ func (_m *PostRepo) Update(post *posts.Post) (*posts.Post, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*posts.Post) error); ok {
-		r1 = rf(post)
+	if rf, ok := ret.Get(1).(func(*posts.Post, ...string) error); ok {
+		r1 = rf(post, fields...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -1,8 +1,10 @@
 package posts
 
 import (
+	"fmt"
 	"redditclone/pkg/comments"
 	"redditclone/pkg/forms"
+	"time"
 )
 
 type Post struct {
@@ -17,21 +19,110 @@ type Post struct {
 	UpVotedPercentage uint32             `json:"upvotePercentage" bson:"upvotePercentage"`
 	Views             uint32             `json:"views" bson:"views"`
 	Type              string             `json:"type" bson:"type"`
-	CurrentTime       string             `json:"created" bson:"created"`
+	CreatedAt         time.Time          `json:"created" bson:"createdAt"`
+	EditedAt          *time.Time         `json:"edited,omitempty" bson:"editedAt,omitempty"` // nil - не редактировался
 	Votes             []*forms.VoteForm  `json:"votes" bson:"votes"`
 	ComCount          int                `json:"count" bson:"count"`
+	// мягкое удаление: пост скрыт из лент, но до очистки его можно восстановить.
+	// Кто и почему удалил, наружу не отдается
+	DeletedAt    *time.Time      `json:"deleted,omitempty" bson:"deletedAt,omitempty"`
+	DeletedBy    *forms.UserForm `json:"-" bson:"deletedBy,omitempty"`
+	DeleteReason string          `json:"-" bson:"deleteReason,omitempty"`
+}
+
+func (p *Post) Deleted() bool {
+	return p.DeletedAt != nil
+}
+
+// имена полей для Update совпадают с bson-тегами Post
+const (
+	FieldTitle            = "title"
+	FieldURL              = "url"
+	FieldText             = "text"
+	FieldCategory         = "category"
+	FieldComments         = "comments"
+	FieldScore            = "score"
+	FieldUpvotePercentage = "upvotePercentage"
+	FieldViews            = "views"
+	FieldType             = "type"
+	FieldVotes            = "votes"
+	FieldComCount         = "count"
+	FieldEdited           = "editedAt"
+	FieldDeletedAt        = "deletedAt"
+	FieldDeletedBy        = "deletedBy"
+	FieldDeleteReason     = "deleteReason"
+)
+
+// DeletionFields - поля мягкого удаления, меняются вместе
+var DeletionFields = []string{FieldDeletedAt, FieldDeletedBy, FieldDeleteReason}
+
+// updatableFields - всё, что можно менять после создания; id, автор и дата создания неизменны
+var updatableFields = map[string]func(dst, src *Post){
+	FieldTitle:            func(dst, src *Post) { dst.Title = src.Title },
+	FieldURL:              func(dst, src *Post) { dst.URL = src.URL },
+	FieldText:             func(dst, src *Post) { dst.Text = src.Text },
+	FieldCategory:         func(dst, src *Post) { dst.Category = src.Category },
+	FieldComments:         func(dst, src *Post) { dst.Comments = src.Comments },
+	FieldScore:            func(dst, src *Post) { dst.Score = src.Score },
+	FieldUpvotePercentage: func(dst, src *Post) { dst.UpVotedPercentage = src.UpVotedPercentage },
+	FieldViews:            func(dst, src *Post) { dst.Views = src.Views },
+	FieldType:             func(dst, src *Post) { dst.Type = src.Type },
+	FieldVotes:            func(dst, src *Post) { dst.Votes = src.Votes },
+	FieldComCount:         func(dst, src *Post) { dst.ComCount = src.ComCount },
+	FieldEdited:           func(dst, src *Post) { dst.EditedAt = src.EditedAt },
+	FieldDeletedAt:        func(dst, src *Post) { dst.DeletedAt = src.DeletedAt },
+	FieldDeletedBy:        func(dst, src *Post) { dst.DeletedBy = src.DeletedBy },
+	FieldDeleteReason:     func(dst, src *Post) { dst.DeleteReason = src.DeleteReason },
+}
+
+// updateFields проверяет маску полей для Update, пустая маска - все изменяемые поля
+func updateFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		fields = make([]string, 0, len(updatableFields))
+		for name := range updatableFields {
+			fields = append(fields, name)
+		}
+		return fields, nil
+	}
+	for _, name := range fields {
+		if _, ok := updatableFields[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrBadField, name)
+		}
+	}
+	return fields, nil
 }
 
 type PostRepo interface {
 	IncreaseViews(newPost *Post)
+	// Feed отбирает и сортирует посты на стороне хранилища, неизвестная сортировка - ranking.ErrUnknownSort
+	Feed(q FeedQuery) ([]*Post, error)
+	// FeedPage - то же постранично: q.Limit постов от курсора q.After или q.Before и курсоры соседних страниц.
+	// Чужой или испорченный курсор - ErrBadCursor
+	FeedPage(q FeedQuery) (*FeedPage, error)
 	GetPostsCategory(category string) ([]*Post, error)
 	GetPostsByUser(author forms.UserForm) ([]*Post, error)
 	GetAll() ([]*Post, error)
 	GetByID(id string) (*Post, error)
 	Add(post *Post) error
-	Update(post *Post) (*Post, error)
-	GetLastId() int
+	// Update сохраняет перечисленные поля поста, без полей - все изменяемые, и возвращает
+	// сохраненный пост. Если поста нет, возвращает ErrNoPost
+	Update(post *Post, fields ...string) (*Post, error)
 	IncreaseVote(fd *forms.VoteForm, post *Post) *Post
 	DecreaseVote(fd *forms.VoteForm, post *Post) *Post
+	// ApplyVote атомарно заменяет голос пользователя (1, -1, 0 - снять голос)
+	// и возвращает пост с пересчитанными score и upvotePercentage
+	ApplyVote(postID, userID string, value int) (*Post, error)
+	// AddView атомарно добавляет просмотр неудаленному посту и возвращает пост со счетчиком
+	AddView(postID string) (*Post, error)
+	// AddComment атомарно добавляет комментарий к неудаленному посту, id комментария -
+	// следующее значение счетчика count. Возвращает пост с новым комментарием
+	AddComment(postID string, c *comments.Comment) (*Post, error)
+	// SetCommentDeletion атомарно помечает комментарий удаленным, at == nil - снимает пометку.
+	// Нет поста - ErrNoPost, нет комментария - ErrNoComment
+	SetCommentDeletion(postID, commentID string, at *time.Time, by *forms.UserForm, reason string) (*Post, error)
+	// Delete удаляет пост насовсем, обычное удаление мягкое - через Update с DeletionFields
 	Delete(id string) bool
+	// PurgeDeleted насовсем удаляет посты и комментарии, мягко удаленные раньше before.
+	// Возвращает id удаленных постов и число удаленных комментариев
+	PurgeDeleted(before time.Time) ([]string, int64, error)
 }
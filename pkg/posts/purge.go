@@ -0,0 +1,44 @@
+package posts
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Purger насовсем удаляет мягко удаленные раньше before посты и комментарии
+type Purger interface {
+	PurgeDeleted(before time.Time) ([]string, int64, error)
+}
+
+// RunPurger раз в interval удаляет то, что пролежало удаленным дольше retention,
+// вместе с историей правок удаленных постов. Возвращается после отмены ctx
+func RunPurger(ctx context.Context, p Purger, revisions RevisionRepo, retention, interval time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purge(p, revisions, now.Add(-retention), logger)
+		}
+	}
+}
+
+func purge(p Purger, revisions RevisionRepo, before time.Time, logger *zap.SugaredLogger) {
+	ids, purgedComments, err := p.PurgeDeleted(before)
+	if err != nil {
+		logger.Errorw("cant purge deleted posts", "err", err)
+	}
+	// посты из ids уже удалены, даже если потом случилась ошибка
+	for _, id := range ids {
+		if err = revisions.Delete(id); err != nil {
+			logger.Errorw("cant delete revisions", "post", id, "err", err)
+		}
+	}
+	if len(ids) > 0 || purgedComments > 0 {
+		logger.Infow("purged deleted posts", "posts", len(ids), "comments", purgedComments)
+	}
+}
@@ -0,0 +1,40 @@
+package posts
+
+import (
+	"redditclone/pkg/forms"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPurge(t *testing.T) {
+	repo := NewInMemoryRepo()
+	revisions := NewRevisionInMemoryRepo()
+	author := forms.UserForm{ID: "1", Login: "ata"}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	deleted := now.Add(-2 * time.Hour)
+
+	for _, id := range []string{"1", "2"} {
+		require.NoError(t, repo.Add(&Post{ID: id, CreatedBy: author, CreatedAt: now.Add(-3 * time.Hour)}))
+		require.NoError(t, revisions.Add(&Revision{PostID: id, EditedBy: author, EditedAt: now, Text: "old"}))
+	}
+	_, err := repo.Update(&Post{ID: "1", DeletedAt: &deleted, DeletedBy: &author}, DeletionFields...)
+	require.NoError(t, err)
+
+	purge(repo, revisions, now.Add(-time.Hour), zap.NewNop().Sugar())
+
+	_, err = repo.GetByID("1")
+	assert.ErrorIs(t, err, ErrNoPost)
+	revs, err := revisions.List("1")
+	require.NoError(t, err)
+	assert.Empty(t, revs, "revisions of a purged post must go too")
+
+	_, err = repo.GetByID("2")
+	assert.NoError(t, err)
+	revs, err = revisions.List("2")
+	require.NoError(t, err)
+	assert.Len(t, revs, 1)
+}
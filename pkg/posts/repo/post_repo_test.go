@@ -21,7 +21,6 @@ func GetPost() ([]*posts.Post, *posts.Post) {
 			Score:             0,
 			UpVotedPercentage: 100,
 			Type:              "text",
-			CurrentTime:       "1",
 			Votes:             make([]*forms.VoteForm, 0, 10),
 			Comments:          []comments.Comment{},
 		},
@@ -36,7 +35,6 @@ func GetPost() ([]*posts.Post, *posts.Post) {
 		Score:             0,
 		UpVotedPercentage: 100,
 		Type:              "text",
-		CurrentTime:       "1",
 		Votes: []*forms.VoteForm{
 			{
 				ID:   "1",
@@ -103,7 +101,6 @@ func TestBadGetByUser(t *testing.T) {
 func TestBadAdd(t *testing.T) {
 	dBase := InitMyRepoTest()
 	_, p := GetPost()
-	dBase.Db.(*mocks.PostRepo).On("GetLastId").Return(1)
 	dBase.Db.(*mocks.PostRepo).On("Add", p).Return(fmt.Errorf("no user"))
 	err1 := dBase.Add(p)
 	assert.Equal(t, err1, fmt.Errorf("no user"))
@@ -113,7 +110,6 @@ func TestGetAllAdd(t *testing.T) {
 	dBase := InitMyRepoTest()
 	expectedPosts, p := GetPost()
 
-	dBase.Db.(*mocks.PostRepo).On("GetLastId").Return(1)
 	dBase.Db.(*mocks.PostRepo).On("Add", p).Return(nil)
 
 	dBase.Db.(*mocks.PostRepo).On("GetAll").Return(expectedPosts, nil)
@@ -186,7 +182,6 @@ func TestPostByCategory(t *testing.T) {
 			Score:             0,
 			UpVotedPercentage: 100,
 			Type:              "text",
-			CurrentTime:       "1",
 			Votes:             make([]*forms.VoteForm, 0, 10),
 			Comments:          []comments.Comment{},
 		},
@@ -201,13 +196,10 @@ func TestPostByCategory(t *testing.T) {
 		Score:             0,
 		UpVotedPercentage: 100,
 		Type:              "text",
-		CurrentTime:       "1",
 		Votes:             make([]*forms.VoteForm, 0, 10),
 		Comments:          []comments.Comment{},
 	}
 
-	dBase.Db.(*mocks.PostRepo).On("GetLastId").Return(1)
-
 	dBase.Db.(*mocks.PostRepo).On("Add", p).Return(nil)
 	dBase.Db.(*mocks.PostRepo).On("GetPostsCategory", "music").Return(expectedPosts, nil)
 
@@ -233,13 +225,11 @@ func TestPostById(t *testing.T) {
 		Score:             0,
 		UpVotedPercentage: 100,
 		Type:              "text",
-		CurrentTime:       "1",
 		Votes:             make([]*forms.VoteForm, 0, 10),
 		Comments:          []comments.Comment{},
 	}
 	p2 := p
 	p2.ID = "2"
-	dBase.Db.(*mocks.PostRepo).On("GetLastId").Return(1)
 
 	dBase.Db.(*mocks.PostRepo).On("Add", p).Return(nil)
 	dBase.Db.(*mocks.PostRepo).On("GetByID", "2").Return(p2, nil)
@@ -265,7 +255,6 @@ func TestPostByUser(t *testing.T) {
 			Score:             0,
 			UpVotedPercentage: 100,
 			Type:              "text",
-			CurrentTime:       "1",
 			Votes:             make([]*forms.VoteForm, 0, 10),
 			Comments:          []comments.Comment{},
 		},
@@ -280,7 +269,6 @@ func TestPostByUser(t *testing.T) {
 		Score:             0,
 		UpVotedPercentage: 100,
 		Type:              "text",
-		CurrentTime:       "1",
 		Votes:             make([]*forms.VoteForm, 0, 10),
 		Comments:          []comments.Comment{},
 	}
@@ -288,7 +276,6 @@ func TestPostByUser(t *testing.T) {
 
 	p2 := p
 	p2.CreatedBy.ID = "2"
-	dBase.Db.(*mocks.PostRepo).On("GetLastId").Return(1)
 
 	dBase.Db.(*mocks.PostRepo).On("Add", p).Return(nil)
 	dBase.Db.(*mocks.PostRepo).On("GetPostsByUser", fd).Return(expectedPosts, nil)
@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"redditclone/pkg/comments"
 	"redditclone/pkg/forms"
+	"redditclone/pkg/idgen"
 	"redditclone/pkg/posts"
 	"redditclone/pkg/posts/mocks"
-	"strconv"
+	"time"
 )
 
 type MyRepo struct {
 	Db posts.PostRepo
+	// IDs выдает id новым постам
+	IDs idgen.Generator
 }
 
 func (d *MyRepo) GetAll() (res []*posts.Post, err error) {
@@ -39,6 +42,16 @@ func (d *MyRepo) GetPostsCategory(category string) (res []*posts.Post, err error
 	return post1, nil
 }
 
+// Feed - лента с сортировкой из ranking. Ошибку сортировки отдаем как есть, чтобы ответить 400
+func (d *MyRepo) Feed(q posts.FeedQuery) ([]*posts.Post, error) {
+	return d.Db.Feed(q)
+}
+
+// FeedPage - страница ленты, ошибки сортировки и курсора тоже отдаем как есть
+func (d *MyRepo) FeedPage(q posts.FeedQuery) (*posts.FeedPage, error) {
+	return d.Db.FeedPage(q)
+}
+
 func (d *MyRepo) GetByID(id string) (*posts.Post, error) {
 	post1, err := d.Db.GetByID(id)
 	if err != nil {
@@ -47,8 +60,8 @@ func (d *MyRepo) GetByID(id string) (*posts.Post, error) {
 	return post1, nil
 }
 
-func (d *MyRepo) Update(post *posts.Post) (*posts.Post, error) {
-	res, err := d.Db.Update(post)
+func (d *MyRepo) Update(post *posts.Post, fields ...string) (*posts.Post, error) {
+	res, err := d.Db.Update(post, fields...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +69,13 @@ func (d *MyRepo) Update(post *posts.Post) (*posts.Post, error) {
 }
 
 func (d *MyRepo) Add(post *posts.Post) error {
-	post.ID = strconv.Itoa(d.Db.GetLastId())
+	id, err := d.IDs.NextID()
+	if err != nil {
+		return fmt.Errorf("cant generate post id: %w", err)
+	}
+	post.ID = id
+	// монга хранит даты с точностью до миллисекунды, округляем сразу, чтобы сравнения совпадали
+	post.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
 	post.Score = 1
 	post.UpVotedPercentage = 100
 	post.Views = 0
@@ -64,7 +83,7 @@ func (d *MyRepo) Add(post *posts.Post) error {
 	post.Votes = make([]*forms.VoteForm, 0, 10)
 	post.Votes = append(post.Votes, &forms.VoteForm{Vote: 1, ID: post.CreatedBy.ID})
 
-	err := d.Db.Add(post)
+	err = d.Db.Add(post)
 	if err != nil {
 		return fmt.Errorf("no user")
 	}
@@ -76,98 +95,48 @@ func (d *MyRepo) Delete(id string) bool {
 	return res
 }
 
-func (d *MyRepo) IncreaseViews(newPost *posts.Post) {
-	newPost.Views++
+func (d *MyRepo) PurgeDeleted(before time.Time) ([]string, int64, error) {
+	return d.Db.PurgeDeleted(before)
 }
 
-func (d *MyRepo) IncreaseVote(fd *forms.VoteForm, post *posts.Post) *posts.Post {
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		return post
-	}
-
-	i := -1
-	for idx, vote := range post.Votes {
-		if vote.ID != fd.ID {
-			continue
-		}
-		i = idx
-	}
+func (d *MyRepo) ApplyVote(postID, userID string, value int) (*posts.Post, error) {
+	return d.Db.ApplyVote(postID, userID, value)
+}
 
-	if i != -1 {
-		if i < len(post.Votes)-1 {
-			copy(post.Votes[i:], post.Votes[i+1:])
-		}
-		post.Votes[len(post.Votes)-1] = nil
-		post.Votes = post.Votes[:len(post.Votes)-1]
-	}
+func (d *MyRepo) AddView(postID string) (*posts.Post, error) {
+	return d.Db.AddView(postID)
+}
 
-	post.Votes = append(post.Votes, fd)
+func (d *MyRepo) AddComment(postID string, c *comments.Comment) (*posts.Post, error) {
+	return d.Db.AddComment(postID, c)
+}
 
-	d.UpvotePercentage(post)
-	d.Score(post)
-	return post
+func (d *MyRepo) SetCommentDeletion(postID, commentID string, at *time.Time, by *forms.UserForm, reason string) (*posts.Post, error) {
+	return d.Db.SetCommentDeletion(postID, commentID, at, by, reason)
 }
 
-func (repo *MyRepo) DecreaseVote(fd *forms.VoteForm, post *posts.Post) *posts.Post {
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		return post
-	}
+func (d *MyRepo) IncreaseViews(newPost *posts.Post) {
+	newPost.Views++
+}
 
-	i := -1
-	for idx, vote := range post.Votes {
-		if vote.ID != fd.ID {
-			continue
-		}
-		i = idx
-	}
+// IncreaseVote, DecreaseVote, UpvotePercentage и Score - общий подсчет голосов из posts
 
-	if i < 0 {
-		return post
-	}
+func (d *MyRepo) IncreaseVote(fd *forms.VoteForm, post *posts.Post) *posts.Post {
+	return posts.IncreaseVote(fd, post)
+}
 
-	if i < len(post.Votes)-1 {
-		copy(post.Votes[i:], post.Votes[i+1:])
-	}
-	post.Votes[len(post.Votes)-1] = nil
-	post.Votes = post.Votes[:len(post.Votes)-1]
-	repo.UpvotePercentage(post)
-	repo.Score(post)
-	return post
+func (d *MyRepo) DecreaseVote(fd *forms.VoteForm, post *posts.Post) *posts.Post {
+	return posts.DecreaseVote(fd, post)
 }
 
 func (d *MyRepo) UpvotePercentage(post *posts.Post) {
-
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		post.UpVotedPercentage = 0
-		return
-	}
-
-	var currNums int
-	for _, vote := range post.Votes {
-		if vote.Vote == 1 {
-			currNums++
-		}
-	}
-	post.UpVotedPercentage = uint32(currNums * 100 / allnum)
+	posts.UpvotePercentage(post)
 }
 
 func (d *MyRepo) Score(post *posts.Post) {
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		post.Score = 0
-		return
-	}
-
-	var currNums int
-	for _, vote := range post.Votes {
-		currNums += vote.Vote
-	}
-	post.Score = currNums
+	posts.Score(post)
 }
 
 func InitMyRepoTest() MyRepo {
-	return MyRepo{Db: &mocks.PostRepo{}}
+	return MyRepo{Db: &mocks.PostRepo{}, IDs: idgen.NewSequence(0)}
 }
@@ -0,0 +1,272 @@
+package posts
+
+import (
+	"fmt"
+	"redditclone/pkg/comments"
+	"redditclone/pkg/forms"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PostInMemoryRepository хранит посты в памяти процесса, без монги.
+// Подходит для локальной разработки и тестов, после рестарта всё теряется
+type PostInMemoryRepository struct {
+	data  map[string]*Post
+	order []string // id в порядке добавления, как естественный порядок в монге
+	mu    *sync.RWMutex
+}
+
+func NewInMemoryRepo() *PostInMemoryRepository {
+	return &PostInMemoryRepository{
+		data:  make(map[string]*Post),
+		order: make([]string, 0, 10),
+		mu:    &sync.RWMutex{},
+	}
+}
+
+// ВСЕ ГЕТТЕРЫ
+
+func (repo *PostInMemoryRepository) GetAll() ([]*Post, error) {
+	return repo.Feed(FeedQuery{})
+}
+
+func (repo *PostInMemoryRepository) GetPostsByUser(author forms.UserForm) ([]*Post, error) {
+	return repo.Feed(FeedQuery{Author: author.Login})
+}
+
+func (repo *PostInMemoryRepository) GetPostsCategory(category string) ([]*Post, error) {
+	return repo.Feed(FeedQuery{Category: category})
+}
+
+func (repo *PostInMemoryRepository) Feed(q FeedQuery) ([]*Post, error) {
+	page, err := repo.FeedPage(q)
+	if err != nil {
+		return nil, err
+	}
+	return page.Posts, nil
+}
+
+// FeedPage считает ранги под блокировкой и копирует только вошедшие в страницу посты
+func (repo *PostInMemoryRepository) FeedPage(q FeedQuery) (*FeedPage, error) {
+	p, err := q.plan()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	found := make([]entry, 0, len(repo.order))
+	for _, id := range repo.order {
+		post := repo.data[id]
+		if !q.match(post, p.since) {
+			continue
+		}
+		e := entry{post: post, rank: p.strategy.Rank(stats(post), p.now), created: post.CreatedAt}
+		if p.cursor != nil && e.cmp(p.cursor) != p.direction() {
+			continue
+		}
+		found = append(found, e)
+	}
+	// при равном ранге - как в монге: сначала свежие, потом по id.
+	// Страницу выше курсора набираем снизу вверх
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].cmp(found[j].key()) == -p.direction()
+	})
+	if q.Limit > 0 && len(found) > q.Limit+1 {
+		found = found[:q.Limit+1]
+	}
+
+	page := q.page(p, found)
+	for i, post := range page.Posts {
+		page.Posts[i] = clonePost(post)
+	}
+	return page, nil
+}
+
+func (repo *PostInMemoryRepository) GetByID(id string) (*Post, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	post, ok := repo.data[id]
+	if !ok {
+		return nil, ErrNoPost
+	}
+	return clonePost(post), nil
+}
+
+// ДОБАВЛЕНИЕ И УДАЛЕНИЕ ПОСТА
+
+func (repo *PostInMemoryRepository) Update(post *Post, fields ...string) (*Post, error) {
+	fields, err := updateFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.data[post.ID]
+	if !ok {
+		return nil, ErrNoPost
+	}
+	updated := clonePost(post)
+	for _, name := range fields {
+		updatableFields[name](stored, updated)
+	}
+	return clonePost(stored), nil
+}
+
+func (repo *PostInMemoryRepository) Add(post *Post) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.data[post.ID]; exists {
+		return fmt.Errorf("post %s already exists", post.ID)
+	}
+	repo.data[post.ID] = clonePost(post)
+	repo.order = append(repo.order, post.ID)
+	return nil
+}
+
+func (repo *PostInMemoryRepository) Delete(id string) bool {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.data[id]; !ok {
+		return false
+	}
+	delete(repo.data, id)
+	for i, postID := range repo.order {
+		if postID == id {
+			repo.order = append(repo.order[:i], repo.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (repo *PostInMemoryRepository) PurgeDeleted(before time.Time) ([]string, int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	ids := make([]string, 0)
+	order := repo.order[:0]
+	for _, id := range repo.order {
+		post := repo.data[id]
+		if post.Deleted() && post.DeletedAt.Before(before) {
+			delete(repo.data, id)
+			ids = append(ids, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	repo.order = order
+
+	var purged int64
+	for _, post := range repo.data {
+		kept := post.Comments[:0:0]
+		for _, comment := range post.Comments {
+			if comment.Deleted() && comment.DeletedAt.Before(before) {
+				purged++
+				continue
+			}
+			kept = append(kept, comment)
+		}
+		if len(kept) != len(post.Comments) {
+			post.Comments = kept
+		}
+	}
+	return ids, purged, nil
+}
+
+// ДРУГИЕ
+
+func (repo *PostInMemoryRepository) IncreaseViews(newPost *Post) {
+	newPost.Views++
+}
+
+func (repo *PostInMemoryRepository) IncreaseVote(fd *forms.VoteForm, post *Post) *Post {
+	return IncreaseVote(fd, post)
+}
+
+func (repo *PostInMemoryRepository) DecreaseVote(fd *forms.VoteForm, post *Post) *Post {
+	return DecreaseVote(fd, post)
+}
+
+func (repo *PostInMemoryRepository) ApplyVote(postID, userID string, value int) (*Post, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.data[postID]
+	if !ok || stored.Deleted() {
+		return nil, ErrNoPost
+	}
+	if err := applyVote(stored, userID, value); err != nil {
+		return nil, err
+	}
+	return clonePost(stored), nil
+}
+
+func (repo *PostInMemoryRepository) AddView(postID string) (*Post, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.data[postID]
+	if !ok || stored.Deleted() {
+		return nil, ErrNoPost
+	}
+	stored.Views++
+	return clonePost(stored), nil
+}
+
+func (repo *PostInMemoryRepository) AddComment(postID string, c *comments.Comment) (*Post, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.data[postID]
+	if !ok || stored.Deleted() {
+		return nil, ErrNoPost
+	}
+	stored.ComCount++
+	c.ID = strconv.Itoa(stored.ComCount)
+	stored.Comments = append(stored.Comments, *c)
+	return clonePost(stored), nil
+}
+
+func (repo *PostInMemoryRepository) SetCommentDeletion(postID, commentID string, at *time.Time, by *forms.UserForm, reason string) (*Post, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.data[postID]
+	if !ok || stored.Deleted() {
+		return nil, ErrNoPost
+	}
+	for i := range stored.Comments {
+		if stored.Comments[i].ID != commentID {
+			continue
+		}
+		c := &stored.Comments[i]
+		c.DeletedAt, c.DeletedBy, c.DeleteReason = at, by, reason
+		return clonePost(stored), nil
+	}
+	return nil, ErrNoComment
+}
+
+// clonePost делает глубокую копию, чтобы вызывающий код не менял хранилище в обход Update
+func clonePost(post *Post) *Post {
+	res := *post
+	if post.Comments != nil {
+		res.Comments = append(post.Comments[:0:0], post.Comments...)
+	}
+	if post.Votes != nil {
+		res.Votes = make([]*forms.VoteForm, 0, len(post.Votes))
+		for _, vote := range post.Votes {
+			v := *vote
+			res.Votes = append(res.Votes, &v)
+		}
+	}
+	return &res
+}
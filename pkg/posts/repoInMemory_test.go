@@ -0,0 +1,67 @@
+package posts
+
+import (
+	"redditclone/pkg/comments"
+	"redditclone/pkg/forms"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPost(id, category string, author forms.UserForm, score int) *Post {
+	return &Post{
+		ID:        id,
+		Title:     "title " + id,
+		Category:  category,
+		CreatedBy: author,
+		Score:     score,
+		Type:      "text",
+		Comments:  []comments.Comment{},
+		Votes:     []*forms.VoteForm{{ID: author.ID, Vote: 1}},
+	}
+}
+
+func TestInMemoryGetters(t *testing.T) {
+	repo := NewInMemoryRepo()
+	ata := forms.UserForm{ID: "1", Login: "ata"}
+	qwe := forms.UserForm{ID: "2", Login: "qwe"}
+
+	assert.NoError(t, repo.Add(newTestPost("1", "music", ata, 1)))
+	assert.NoError(t, repo.Add(newTestPost("2", "funny", qwe, 5)))
+	assert.NoError(t, repo.Add(newTestPost("3", "music", qwe, 3)))
+	assert.Error(t, repo.Add(newTestPost("3", "music", qwe, 3)))
+
+	all, err := repo.GetAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "1"}, ids(all))
+
+	music, _ := repo.GetPostsCategory("music")
+	assert.Equal(t, []string{"3", "1"}, ids(music))
+
+	byUser, _ := repo.GetPostsByUser(qwe)
+	assert.Equal(t, []string{"2", "3"}, ids(byUser))
+
+	_, err = repo.GetByID("42")
+	assert.Equal(t, ErrNoPost, err)
+
+	// изменения полученной копии не попадают в хранилище без Update
+	post, _ := repo.GetByID("1")
+	post.Score = 100
+	post.Votes[0].Vote = -1
+	stored, _ := repo.GetByID("1")
+	assert.Equal(t, 1, stored.Score)
+	assert.Equal(t, 1, stored.Votes[0].Vote)
+
+	assert.True(t, repo.Delete("1"))
+	assert.False(t, repo.Delete("1"))
+	all, _ = repo.GetAll()
+	assert.Equal(t, []string{"2", "3"}, ids(all))
+}
+
+func ids(posts []*Post) []string {
+	res := make([]string, 0, len(posts))
+	for _, post := range posts {
+		res = append(res, post.ID)
+	}
+	return res
+}
@@ -6,129 +6,183 @@ import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"gopkg.in/mgo.v2"
-	"log"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"redditclone/pkg/comments"
 	"redditclone/pkg/forms"
-	"sort"
+	"redditclone/pkg/ranking"
+	"time"
 )
 
 var (
-	ErrNoPost = errors.New(" No post found")
+	ErrNoPost   = errors.New(" No post found")
+	ErrBadField = errors.New(" Unknown post field")
+	ErrBadVote  = errors.New(" Vote must be 1, -1 or 0")
+	// ErrNoComment - в посте нет комментария с таким id
+	ErrNoComment = errors.New(" No comment found")
 )
 
 type PostMemoryRepository struct {
-	data   *mongo.Collection
-	LastId int
+	data *mongo.Collection
 }
 
 func NewMemoryRepo(collection *mongo.Collection) *PostMemoryRepository {
 	return &PostMemoryRepository{
-		data:   collection,
-		LastId: 1,
+		data: collection,
 	}
 }
 
 // ВСЕ ГЕТТЕРЫ
 
 func (repo *PostMemoryRepository) GetAll() (res []*Post, err error) {
-	post1 := []*Post{}
-
-	cur, err := repo.data.Find(context.TODO(), bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	for cur.Next(context.TODO()) {
+	return repo.Feed(FeedQuery{})
+}
 
-		// create a value into which the single document can be decoded
-		var elem Post
-		err := cur.Decode(&elem)
-		if err != nil {
-			log.Fatal(err)
-		}
+func (repo *PostMemoryRepository) GetPostsByUser(author forms.UserForm) (res []*Post, err error) {
+	return repo.Feed(FeedQuery{Author: author.Login})
+}
 
-		post1 = append(post1, &elem)
-	}
+func (repo *PostMemoryRepository) GetPostsCategory(category string) (res []*Post, err error) {
+	return repo.Feed(FeedQuery{Category: category})
+}
 
-	if err := cur.Err(); err != nil {
-		log.Fatal(err)
+func (repo *PostMemoryRepository) Feed(q FeedQuery) ([]*Post, error) {
+	page, err := repo.FeedPage(q)
+	if err != nil {
+		return nil, err
 	}
+	return page.Posts, nil
+}
 
-	// Close the cursor once finished
-	cur.Close(context.TODO())
-
-	sort.SliceStable(post1, func(i, j int) bool {
-		return post1[i].Score >= post1[i].Score
-	})
-	return post1, nil
-
+// rankedPost - пост вместе с ключом сортировки, посчитанным в агрегате
+type rankedPost struct {
+	Post    `bson:",inline"`
+	Rank    float64   `bson:"_rank"`
+	Created time.Time `bson:"_created"`
 }
 
-func (repo *PostMemoryRepository) GetPostsByUser(author forms.UserForm) (res []*Post, err error) {
-	post1 := []*Post{}
+// sortKey - поле ключа сортировки ленты и его значение в курсоре
+type sortKey struct {
+	field string
+	value interface{}
+}
 
-	cur, err := repo.data.Find(context.TODO(), bson.M{"author": author})
+// FeedPage отбирает, ранжирует и обрезает ленту одним агрегатом, из базы приходят только посты страницы.
+// Для new и top ключ - сохраненные поля (score, createdAt, _id), и монга идет по индексу.
+// Остальным стратегиям ранг считается выражением по голосам и дате создания, ключ -
+// (_rank, _created, _id). Страница отсчитывается от курсора по ключу
+func (repo *PostMemoryRepository) FeedPage(q FeedQuery) (*FeedPage, error) {
+	p, err := q.plan()
 	if err != nil {
 		return nil, err
 	}
-	for cur.Next(context.TODO()) {
 
-		// create a value into which the single document can be decoded
-		var elem Post
-		err := cur.Decode(&elem)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		post1 = append(post1, &elem)
+	match := bson.M{"deletedAt": nil}
+	if q.Category != "" {
+		match["category"] = q.Category
 	}
-
-	if err := cur.Err(); err != nil {
-		log.Fatal(err)
+	if q.Author != "" {
+		match["author.login"] = q.Author
 	}
+	if !p.since.IsZero() {
+		match["createdAt"] = bson.M{"$gte": p.since}
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
 
-	// Close the cursor once finished
-	cur.Close(context.TODO())
-	sort.SliceStable(post1, func(i, j int) bool {
-		return post1[i].Score >= post1[i].Score
-	})
-	return post1, nil
-}
+	c := p.cursor
+	if c == nil {
+		c = &Cursor{}
+	}
+	var keys []sortKey
+	stored, isStored := p.strategy.(ranking.Stored)
+	switch {
+	case isStored && stored.SortField() == "createdAt":
+		// ранг new - сама дата создания
+		keys = []sortKey{{"createdAt", c.CreatedAt}, {"_id", c.ID}}
+	case isStored:
+		keys = []sortKey{{stored.SortField(), c.Rank}, {"createdAt", c.CreatedAt}, {"_id", c.ID}}
+	default:
+		keys = []sortKey{{"_rank", c.Rank}, {"_created", c.CreatedAt}, {"_id", c.ID}}
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: rankFields(p)}})
+	}
 
-func (repo *PostMemoryRepository) GetPostsCategory(category string) (res []*Post, err error) {
-	post1 := []*Post{}
+	// ниже курсора - по убыванию ключа, выше - по возрастанию, ближние к курсору первыми
+	order, cmp := -1, "$lt"
+	if p.reverse {
+		order, cmp = 1, "$gt"
+	}
+	if p.cursor != nil {
+		// (k1 < v1) или (k1 = v1 и k2 < v2) или ...
+		or := bson.A{}
+		for i, key := range keys {
+			cond := bson.M{key.field: bson.M{cmp: key.value}}
+			for _, prev := range keys[:i] {
+				cond[prev.field] = prev.value
+			}
+			or = append(or, cond)
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": or}}})
+	}
+	sort := bson.D{}
+	for _, key := range keys {
+		sort = append(sort, bson.E{Key: key.field, Value: order})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: q.Limit + 1}})
+	}
 
-	cur, err := repo.data.Find(context.TODO(), bson.M{"category": category})
+	cur, err := repo.data.Aggregate(context.TODO(), pipeline)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("feed: %w", err)
 	}
-	for cur.Next(context.TODO()) {
-
-		// create a value into which the single document can be decoded
-		var elem Post
-		err := cur.Decode(&elem)
-		if err != nil {
-			return nil, fmt.Errorf("no user")
+	res := []*rankedPost{}
+	if err = cur.All(context.TODO(), &res); err != nil {
+		return nil, fmt.Errorf("feed: %w", err)
+	}
+	found := make([]entry, 0, len(res))
+	for _, r := range res {
+		post := r.Post
+		e := entry{post: &post, rank: r.Rank, created: r.Created}
+		if isStored {
+			// ранг от сохраненного поля считаем уже после отбора, только для страницы
+			e.rank, e.created = p.strategy.Rank(stats(&post), p.now), post.CreatedAt
 		}
-
-		post1 = append(post1, &elem)
+		found = append(found, e)
 	}
+	return q.page(p, found), nil
+}
 
-	if err := cur.Err(); err != nil {
-		return nil, fmt.Errorf("no user")
+// rankFields - ранг стратегии и дата создания, посчитанные агрегатом для каждого поста
+func rankFields(p *feedPlan) bson.M {
+	votes := func(value int) bson.M {
+		return bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$votes", bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this.vote", value}},
+		}}}
+	}
+	// посты без даты считаем самыми старыми
+	created := bson.M{"$ifNull": bson.A{"$createdAt", time.Unix(0, 0)}}
+	return bson.M{
+		"_created": created,
+		"_rank": bson.M{"$let": bson.M{
+			"vars": bson.M{
+				"score":   bson.M{"$ifNull": bson.A{"$score", 0}},
+				"ups":     votes(1),
+				"downs":   votes(-1),
+				"created": created,
+			},
+			"in": p.strategy.MongoRank(p.now),
+		}},
 	}
-
-	// Close the cursor once finished
-	cur.Close(context.TODO())
-	sort.SliceStable(post1, func(i, j int) bool {
-		return post1[i].Score >= post1[i].Score
-	})
-	return post1, nil
 }
 
 func (repo *PostMemoryRepository) GetByID(id string) (*Post, error) {
 	posts := &Post{}
 
 	pos := repo.data.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&posts)
+	if pos == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
+	}
 	if pos != nil {
 		return nil, fmt.Errorf("no user")
 	}
@@ -137,30 +191,40 @@ func (repo *PostMemoryRepository) GetByID(id string) (*Post, error) {
 
 // ДОБАВЛЕНИЕ И УДАЛЕНИЕ ПОСТА
 
-func (repo *PostMemoryRepository) Update(post *Post) (*Post, error) {
-	//posts := &posts.Post{}
-	update := bson.D{{"$set", bson.M{"comments": post.Comments, "score": post.Score, "upvotePercentage": post.UpVotedPercentage}}}
-	_, pos := repo.data.UpdateOne(context.TODO(), bson.M{"_id": post.ID}, update)
-	if pos != nil {
-		return nil, fmt.Errorf("no user")
+func (repo *PostMemoryRepository) Update(post *Post, fields ...string) (*Post, error) {
+	fields, err := updateFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// берем значения через bson, чтобы имена полей точно совпали с тегами
+	raw, err := bson.Marshal(post)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	set := bson.M{}
+	for _, name := range fields {
+		set[name] = doc[name]
 	}
-	return post, nil
-}
 
-func (repo *PostMemoryRepository) GetLastId() int {
-	return repo.LastId
+	update := bson.D{{Key: "$set", Value: set}}
+	stored := &Post{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = repo.data.FindOneAndUpdate(context.TODO(), bson.M{"_id": post.ID}, update, opts).Decode(stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update post %s: %w", post.ID, err)
+	}
+	return stored, nil
 }
 
 func (repo *PostMemoryRepository) Add(post *Post) error {
-
-	//post.ID = strconv.Itoa(repo.GetLastId())
-	//post.Score = 1
-	//post.UpVotedPercentage = 100
-	//post.Views = 0
-	//post.Comments = []comments.Comment{}
-	//post.Votes = make([]*forms.VoteForm, 0, 10)
-	//post.Votes = append(post.Votes, &forms.VoteForm{Vote: 1, ID: post.CreatedBy.ID})
-	repo.LastId++
 	_, err := repo.data.InsertOne(context.TODO(), post)
 	if err != nil {
 		return fmt.Errorf("no user")
@@ -169,14 +233,69 @@ func (repo *PostMemoryRepository) Add(post *Post) error {
 }
 
 func (repo *PostMemoryRepository) Delete(id string) bool {
-	_, err := repo.data.DeleteOne(context.TODO(), bson.M{"_id": id})
-	if err == mgo.ErrNotFound {
+	res, err := repo.data.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil || res.DeletedCount == 0 {
 		return false
 	}
 	return true
 
 }
 
+// PurgeDeleted сначала удаляет посты, потом вычищает комментарии из оставшихся.
+// Ключ даты удаления у комментария - deletedat, как у остальных его полей
+func (repo *PostMemoryRepository) PurgeDeleted(before time.Time) ([]string, int64, error) {
+	ctx := context.TODO()
+	filter := bson.M{"deletedAt": bson.M{"$lt": before}}
+	cur, err := repo.data.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("purge posts: %w", err)
+	}
+	found := []struct {
+		ID string `bson:"_id"`
+	}{}
+	if err = cur.All(ctx, &found); err != nil {
+		return nil, 0, fmt.Errorf("purge posts: %w", err)
+	}
+	ids := make([]string, 0, len(found))
+	for _, f := range found {
+		ids = append(ids, f.ID)
+	}
+	if len(ids) > 0 {
+		if _, err = repo.data.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return nil, 0, fmt.Errorf("purge posts: %w", err)
+		}
+	}
+
+	expired := bson.M{"deletedat": bson.M{"$lt": before}}
+	// сколько комментариев уйдет, $pull сам не сообщает
+	counted, err := repo.data.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"comments": bson.M{"$elemMatch": expired}}}},
+		{{Key: "$unwind", Value: "$comments"}},
+		{{Key: "$match", Value: bson.M{"comments.deletedat": bson.M{"$lt": before}}}},
+		{{Key: "$count", Value: "n"}},
+	})
+	if err != nil {
+		return ids, 0, fmt.Errorf("purge comments: %w", err)
+	}
+	total := []struct {
+		N int64 `bson:"n"`
+	}{}
+	if err = counted.All(ctx, &total); err != nil {
+		return ids, 0, fmt.Errorf("purge comments: %w", err)
+	}
+	if len(total) == 0 {
+		return ids, 0, nil
+	}
+	_, err = repo.data.UpdateMany(ctx,
+		bson.M{"comments": bson.M{"$elemMatch": expired}},
+		bson.M{"$pull": bson.M{"comments": expired}},
+	)
+	if err != nil {
+		return ids, 0, fmt.Errorf("purge comments: %w", err)
+	}
+	return ids, total[0].N, nil
+}
+
 // ДРУГИЕ
 
 func (repo *PostMemoryRepository) IncreaseViews(newPost *Post) {
@@ -184,89 +303,155 @@ func (repo *PostMemoryRepository) IncreaseViews(newPost *Post) {
 }
 
 func (repo *PostMemoryRepository) IncreaseVote(fd *forms.VoteForm, post *Post) *Post {
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		return post
-	}
+	return IncreaseVote(fd, post)
+}
 
-	i := -1
-	for idx, vote := range post.Votes {
-		if vote.ID != fd.ID {
-			continue
-		}
-		i = idx
+func (repo *PostMemoryRepository) DecreaseVote(fd *forms.VoteForm, post *Post) *Post {
+	return DecreaseVote(fd, post)
+}
+
+// ApplyVote меняет голос одним update-пайплайном на стороне монги (нужна 4.2+),
+// так что параллельные голосования не затирают друг друга
+func (repo *PostMemoryRepository) AddView(postID string) (*Post, error) {
+	post := &Post{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": postID, "deletedAt": nil}
+	update := bson.M{"$inc": bson.M{"views": 1}}
+	err := repo.data.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
 	}
+	if err != nil {
+		return nil, fmt.Errorf("view post %s: %w", postID, err)
+	}
+	return post, nil
+}
 
-	if i != -1 {
-		if i < len(post.Votes)-1 {
-			copy(post.Votes[i:], post.Votes[i+1:])
-		}
-		post.Votes[len(post.Votes)-1] = nil
-		post.Votes = post.Votes[:len(post.Votes)-1]
+func (repo *PostMemoryRepository) ApplyVote(postID, userID string, value int) (*Post, error) {
+	if value < -1 || value > 1 {
+		return nil, ErrBadVote
 	}
 
-	post.Votes = append(post.Votes, fd)
+	newVotes := bson.A{}
+	if value != 0 {
+		newVotes = append(newVotes, bson.M{"id": userID, "vote": value})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"votes": bson.M{"$concatArrays": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$votes", bson.A{}}},
+					"cond":  bson.M{"$ne": bson.A{"$$this.id", userID}},
+				}},
+				newVotes,
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"score": bson.M{"$sum": "$votes.vote"},
+			"upvotePercentage": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$size": "$votes"}, 0}},
+				0,
+				bson.M{"$toInt": bson.M{"$floor": bson.M{"$divide": bson.A{
+					bson.M{"$multiply": bson.A{
+						bson.M{"$size": bson.M{"$filter": bson.M{
+							"input": "$votes",
+							"cond":  bson.M{"$eq": bson.A{"$$this.vote", 1}},
+						}}},
+						100,
+					}},
+					bson.M{"$size": "$votes"},
+				}}}},
+			}},
+		}}},
+	}
 
-	repo.UpvotePercentage(post)
-	repo.Score(post)
-	return post
+	post := &Post{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	// за удаленные посты не голосуют
+	filter := bson.M{"_id": postID, "deletedAt": nil}
+	err := repo.data.FindOneAndUpdate(context.TODO(), filter, pipeline, opts).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vote post %s: %w", postID, err)
+	}
+	return post, nil
 }
 
-func (repo *PostMemoryRepository) DecreaseVote(fd *forms.VoteForm, post *Post) *Post {
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		return post
+// AddComment увеличивает count и дописывает комментарий с id из него одним update-пайплайном.
+// Комментарий вставляется через $literal, чтобы текст вида "$field" не считался выражением
+func (repo *PostMemoryRepository) AddComment(postID string, c *comments.Comment) (*Post, error) {
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return nil, err
 	}
-
-	i := -1
-	for idx, vote := range post.Votes {
-		if vote.ID != fd.ID {
-			continue
-		}
-		i = idx
+	doc := bson.M{}
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
 	}
-
-	if i < 0 {
-		return post
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"count": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$count", 0}}, 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"comments": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$comments", bson.A{}}},
+				bson.A{bson.M{"$mergeObjects": bson.A{
+					bson.M{"$literal": doc},
+					bson.M{"id": bson.M{"$toString": "$count"}},
+				}}},
+			}},
+		}}},
 	}
 
-	if i < len(post.Votes)-1 {
-		copy(post.Votes[i:], post.Votes[i+1:])
+	post := &Post{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": postID, "deletedAt": nil}
+	err = repo.data.FindOneAndUpdate(context.TODO(), filter, pipeline, opts).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
 	}
-	post.Votes[len(post.Votes)-1] = nil
-	post.Votes = post.Votes[:len(post.Votes)-1]
-	repo.UpvotePercentage(post)
-	repo.Score(post)
-	return post
+	if err != nil {
+		return nil, fmt.Errorf("comment post %s: %w", postID, err)
+	}
+	c.ID = post.Comments[len(post.Comments)-1].ID
+	return post, nil
 }
 
-func (repo *PostMemoryRepository) UpvotePercentage(post *Post) {
-
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		post.UpVotedPercentage = 0
-		return
+// SetCommentDeletion меняет только поля одного комментария через arrayFilters,
+// остальные комментарии и параллельные добавления не затрагиваются
+func (repo *PostMemoryRepository) SetCommentDeletion(postID, commentID string, at *time.Time, by *forms.UserForm, reason string) (*Post, error) {
+	const c = "comments.$[c]."
+	update := bson.M{"$unset": bson.M{c + "deletedat": "", c + "deletedby": "", c + "deletereason": ""}}
+	if at != nil {
+		update = bson.M{"$set": bson.M{c + "deletedat": at, c + "deletedby": by, c + "deletereason": reason}}
 	}
 
-	var currNums int
-	for _, vote := range post.Votes {
-		if vote.Vote == 1 {
-			currNums++
+	post := &Post{}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"c.id": commentID}}})
+	filter := bson.M{"_id": postID, "deletedAt": nil, "comments.id": commentID}
+	err := repo.data.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		// отличаем отсутствие поста от отсутствия комментария
+		n, errCount := repo.data.CountDocuments(context.TODO(), bson.M{"_id": postID, "deletedAt": nil})
+		if errCount == nil && n > 0 {
+			return nil, ErrNoComment
 		}
+		return nil, ErrNoPost
+	}
+	if err != nil {
+		return nil, fmt.Errorf("comment post %s: %w", postID, err)
 	}
-	post.UpVotedPercentage = uint32(currNums * 100 / allnum)
+	return post, nil
 }
 
-func (repo *PostMemoryRepository) Score(post *Post) {
-	allnum := len(post.Votes)
-	if allnum == 0 {
-		post.Score = 0
-		return
-	}
+func (repo *PostMemoryRepository) UpvotePercentage(post *Post) {
+	UpvotePercentage(post)
+}
 
-	var currNums int
-	for _, vote := range post.Votes {
-		currNums += vote.Vote
-	}
-	post.Score = currNums
+func (repo *PostMemoryRepository) Score(post *Post) {
+	Score(post)
 }
@@ -0,0 +1,758 @@
+// Package repotest - общий набор тестов, которому должно соответствовать любое хранилище постов.
+//
+//	func TestMyBackend(t *testing.T) {
+//		repotest.RunPostRepoSuite(t, func(t *testing.T) posts.PostRepo {
+//			return NewMyBackend(...)
+//		})
+//	}
+package repotest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"redditclone/pkg/comments"
+	"redditclone/pkg/forms"
+	"redditclone/pkg/posts"
+	"redditclone/pkg/ranking"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory возвращает пустое хранилище; каждый тест набора получает своё
+type Factory func(t *testing.T) posts.PostRepo
+
+var (
+	ata = forms.UserForm{ID: "1", Login: "ata"}
+	qwe = forms.UserForm{ID: "2", Login: "qwe"}
+)
+
+func RunPostRepoSuite(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo posts.PostRepo)
+	}{
+		{"AddGet", testAddGet},
+		{"GetMissing", testGetMissing},
+		{"Update", testUpdate},
+		{"UpdateAllFields", testUpdateAllFields},
+		{"UpdateFieldMask", testUpdateFieldMask},
+		{"UpdateMissing", testUpdateMissing},
+		{"Delete", testDelete},
+		{"SoftDelete", testSoftDelete},
+		{"PurgeDeleted", testPurgeDeleted},
+		{"CategoryFilter", testCategoryFilter},
+		{"AuthorFilter", testAuthorFilter},
+		{"Ordering", testOrdering},
+		{"Feed", testFeed},
+		{"FeedPages", testFeedPages},
+		{"Votes", testVotes},
+		{"ApplyVote", testApplyVote},
+		{"ConcurrentApplyVote", testConcurrentApplyVote},
+		{"ConcurrentViews", testConcurrentViews},
+		{"Comments", testComments},
+		{"ConcurrentComments", testConcurrentComments},
+		{"ConcurrentAdd", testConcurrentAdd},
+		{"ConcurrentReadUpdate", testConcurrentReadUpdate},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo(t))
+		})
+	}
+}
+
+// created - дата постов из NewPost, с точностью монги до миллисекунды
+var created = time.Date(2022, 5, 10, 13, 45, 57, 613000000, time.UTC)
+
+// NewPost - пост в том виде, в каком его сохраняет repo.MyRepo.Add
+func NewPost(id, category string, author forms.UserForm) *posts.Post {
+	return &posts.Post{
+		ID:                id,
+		Title:             "title " + id,
+		Text:              "text " + id,
+		Category:          category,
+		CreatedBy:         author,
+		Type:              "text",
+		CreatedAt:         created,
+		Score:             1,
+		UpVotedPercentage: 100,
+		Comments:          []comments.Comment{},
+		Votes:             []*forms.VoteForm{{ID: author.ID, Vote: 1}},
+	}
+}
+
+func mustAdd(t *testing.T, repo posts.PostRepo, post *posts.Post) {
+	t.Helper()
+	require.NoError(t, repo.Add(post))
+}
+
+func ids(res []*posts.Post) []string {
+	out := make([]string, 0, len(res))
+	for _, post := range res {
+		out = append(out, post.ID)
+	}
+	return out
+}
+
+func testAddGet(t *testing.T, repo posts.PostRepo) {
+	post := NewPost("1", "music", ata)
+	mustAdd(t, repo, post)
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Equal(t, post.Title, got.Title)
+	assert.Equal(t, post.Text, got.Text)
+	assert.Equal(t, post.Category, got.Category)
+	assert.Equal(t, post.CreatedBy, got.CreatedBy)
+	assert.Equal(t, post.Score, got.Score)
+	assert.Equal(t, post.UpVotedPercentage, got.UpVotedPercentage)
+	assert.Len(t, got.Votes, 1)
+	assert.True(t, created.Equal(got.CreatedAt), "created: %v", got.CreatedAt)
+	assert.Nil(t, got.EditedAt)
+
+	assert.Error(t, repo.Add(NewPost("1", "music", ata)), "duplicate id must be rejected")
+}
+
+func testGetMissing(t *testing.T, repo posts.PostRepo) {
+	_, err := repo.GetByID("42")
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func testUpdate(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	post, err := repo.GetByID("1")
+	require.NoError(t, err)
+	edited := created.Add(time.Hour)
+	post.Comments = append(post.Comments, comments.Comment{
+		ID:          "1",
+		Description: "zxc",
+		CreatedBy:   qwe,
+		CreatedAt:   created.Add(time.Minute),
+		EditedAt:    &edited,
+	})
+	post.Score = 7
+	post.UpVotedPercentage = 50
+
+	_, err = repo.Update(post)
+	require.NoError(t, err)
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	require.Len(t, got.Comments, 1)
+	assert.Equal(t, "zxc", got.Comments[0].Description)
+	assert.True(t, created.Add(time.Minute).Equal(got.Comments[0].CreatedAt))
+	require.NotNil(t, got.Comments[0].EditedAt)
+	assert.True(t, edited.Equal(*got.Comments[0].EditedAt))
+	assert.Equal(t, 7, got.Score)
+	assert.Equal(t, uint32(50), got.UpVotedPercentage)
+}
+
+func testUpdateAllFields(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	post, err := repo.GetByID("1")
+	require.NoError(t, err)
+	post.Title = "new title"
+	post.Text = "new text"
+	post.Category = "funny"
+	post.Views = 5
+	post.ComCount = 3
+	post.Votes = append(post.Votes, &forms.VoteForm{ID: qwe.ID, Vote: -1})
+
+	_, err = repo.Update(post)
+	require.NoError(t, err)
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Equal(t, "new title", got.Title)
+	assert.Equal(t, "new text", got.Text)
+	assert.Equal(t, "funny", got.Category)
+	assert.Equal(t, uint32(5), got.Views)
+	assert.Equal(t, 3, got.ComCount)
+	require.Len(t, got.Votes, 2)
+	assert.Equal(t, forms.VoteForm{ID: qwe.ID, Vote: -1}, *got.Votes[1])
+}
+
+func testUpdateFieldMask(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	post, err := repo.GetByID("1")
+	require.NoError(t, err)
+	post.Views = 10
+	post.Title = "not saved"
+
+	res, err := repo.Update(post, posts.FieldViews)
+	require.NoError(t, err)
+	// возвращается сохраненный пост, а не переданный
+	assert.NotSame(t, post, res)
+	assert.Equal(t, uint32(10), res.Views)
+	assert.Equal(t, "title 1", res.Title)
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(10), got.Views)
+	assert.Equal(t, "title 1", got.Title, "fields outside the mask must not change")
+
+	_, err = repo.Update(post, "author")
+	assert.True(t, errors.Is(err, posts.ErrBadField), "want ErrBadField, got %v", err)
+}
+
+func testUpdateMissing(t *testing.T, repo posts.PostRepo) {
+	_, err := repo.Update(NewPost("42", "music", ata))
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+
+	_, err = repo.GetByID("42")
+	assert.Error(t, err, "update must not create posts")
+}
+
+func testDelete(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+	mustAdd(t, repo, NewPost("2", "music", ata))
+
+	assert.True(t, repo.Delete("1"))
+	assert.False(t, repo.Delete("1"), "second delete of the same id must report failure")
+	assert.False(t, repo.Delete("42"))
+
+	_, err := repo.GetByID("1")
+	assert.Error(t, err)
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(all))
+}
+
+// softDelete помечает пост удаленным так же, как это делает обработчик
+func softDelete(t *testing.T, repo posts.PostRepo, id string, at time.Time) {
+	t.Helper()
+	post, err := repo.GetByID(id)
+	require.NoError(t, err)
+	post.DeletedAt = &at
+	post.DeletedBy = &ata
+	post.DeleteReason = "spam"
+	_, err = repo.Update(post, posts.DeletionFields...)
+	require.NoError(t, err)
+}
+
+func testSoftDelete(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+	mustAdd(t, repo, NewPost("2", "music", ata))
+	deleted := created.Add(time.Hour)
+	softDelete(t, repo, "1", deleted)
+
+	// удаленный пост не виден в лентах, но читается по id
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(all))
+	res, err := repo.GetPostsCategory("music")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(res))
+	res, err = repo.GetPostsByUser(ata)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(res))
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	require.True(t, got.Deleted())
+	assert.True(t, deleted.Equal(*got.DeletedAt), "deleted: %v", got.DeletedAt)
+	assert.Equal(t, &ata, got.DeletedBy)
+	assert.Equal(t, "spam", got.DeleteReason)
+
+	_, err = repo.ApplyVote("1", qwe.ID, 1)
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+
+	// восстановление
+	got.DeletedAt, got.DeletedBy, got.DeleteReason = nil, nil, ""
+	_, err = repo.Update(got, posts.DeletionFields...)
+	require.NoError(t, err)
+	got, err = repo.GetByID("1")
+	require.NoError(t, err)
+	assert.False(t, got.Deleted())
+	assert.Nil(t, got.DeletedBy)
+	all, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, ids(all))
+}
+
+func testPurgeDeleted(t *testing.T, repo posts.PostRepo) {
+	expired, fresh := created.Add(time.Hour), created.Add(3*time.Hour)
+	before := created.Add(2 * time.Hour)
+	for _, id := range []string{"1", "2", "3"} {
+		mustAdd(t, repo, NewPost(id, "music", ata))
+	}
+	softDelete(t, repo, "1", expired)
+	softDelete(t, repo, "2", fresh)
+
+	post, err := repo.GetByID("3")
+	require.NoError(t, err)
+	post.Comments = []comments.Comment{
+		{ID: "1", Description: "old", CreatedBy: qwe, CreatedAt: created, DeletedAt: &expired, DeletedBy: &qwe},
+		{ID: "2", Description: "new", CreatedBy: qwe, CreatedAt: created, DeletedAt: &fresh, DeletedBy: &qwe},
+		{ID: "3", Description: "live", CreatedBy: qwe, CreatedAt: created},
+	}
+	_, err = repo.Update(post, posts.FieldComments)
+	require.NoError(t, err)
+
+	purged, purgedComments, err := repo.PurgeDeleted(before)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, purged)
+	assert.Equal(t, int64(1), purgedComments)
+
+	_, err = repo.GetByID("1")
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+	got, err := repo.GetByID("2")
+	require.NoError(t, err)
+	assert.True(t, got.Deleted(), "not expired yet")
+	got, err = repo.GetByID("3")
+	require.NoError(t, err)
+	commentIDs := []string{}
+	for _, c := range got.Comments {
+		commentIDs = append(commentIDs, c.ID)
+	}
+	assert.Equal(t, []string{"2", "3"}, commentIDs)
+
+	purged, purgedComments, err = repo.PurgeDeleted(before)
+	require.NoError(t, err)
+	assert.Empty(t, purged, "second run has nothing to purge")
+	assert.Zero(t, purgedComments)
+}
+
+func testCategoryFilter(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+	mustAdd(t, repo, NewPost("2", "funny", ata))
+	mustAdd(t, repo, NewPost("3", "music", qwe))
+
+	res, err := repo.GetPostsCategory("music")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "3"}, ids(res))
+
+	res, err = repo.GetPostsCategory("news")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func testAuthorFilter(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+	mustAdd(t, repo, NewPost("2", "funny", qwe))
+	mustAdd(t, repo, NewPost("3", "music", qwe))
+
+	res, err := repo.GetPostsByUser(qwe)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "3"}, ids(res))
+
+	res, err = repo.GetPostsByUser(forms.UserForm{ID: "3", Login: "nobody"})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func testOrdering(t *testing.T, repo posts.PostRepo) {
+	scores := map[string]int{"1": 2, "2": -1, "3": 10, "4": 5}
+	for _, id := range []string{"1", "2", "3", "4"} {
+		post := NewPost(id, "music", ata)
+		post.Score = scores[id]
+		mustAdd(t, repo, post)
+	}
+
+	want := []string{"3", "4", "1", "2"}
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, want, ids(all), "GetAll must sort by score desc")
+
+	res, err := repo.GetPostsCategory("music")
+	require.NoError(t, err)
+	assert.Equal(t, want, ids(res), "GetPostsCategory must sort by score desc")
+
+	res, err = repo.GetPostsByUser(ata)
+	require.NoError(t, err)
+	assert.Equal(t, want, ids(res), "GetPostsByUser must sort by score desc")
+}
+
+// withVotes - пост с ups голосами за и downs против, созданный age назад от now
+func withVotes(post *posts.Post, now time.Time, age time.Duration, ups, downs int) *posts.Post {
+	post.CreatedAt = now.Add(-age)
+	post.Votes = make([]*forms.VoteForm, 0, ups+downs)
+	for i := 0; i < ups+downs; i++ {
+		vote := 1
+		if i >= ups {
+			vote = -1
+		}
+		post.Votes = append(post.Votes, &forms.VoteForm{ID: strconv.Itoa(i), Vote: vote})
+	}
+	post.Score = ups - downs
+	return post
+}
+
+func testFeed(t *testing.T, repo posts.PostRepo) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	mustAdd(t, repo, withVotes(NewPost("1", "music", ata), now, 10*day, 60, 10))
+	mustAdd(t, repo, withVotes(NewPost("2", "music", ata), now, 2*time.Hour, 5, 0))
+	mustAdd(t, repo, withVotes(NewPost("3", "funny", qwe), now, 30*time.Minute, 3, 2))
+	mustAdd(t, repo, withVotes(NewPost("4", "music", qwe), now, 3*day, 20, 20))
+	mustAdd(t, repo, withVotes(NewPost("5", "music", ata), now, 20*time.Hour, 30, 5))
+
+	cases := []struct {
+		name string
+		q    posts.FeedQuery
+		want []string
+	}{
+		{"default is top", posts.FeedQuery{}, []string{"1", "5", "2", "3", "4"}},
+		{"new", posts.FeedQuery{Sort: ranking.SortNew}, []string{"3", "2", "5", "4", "1"}},
+		{"top day", posts.FeedQuery{Sort: ranking.SortTop, Window: day}, []string{"5", "2", "3"}},
+		// свежесть перевешивает рейтинг: 12.5 часов стоят десятикратного рейтинга
+		{"hot", posts.FeedQuery{Sort: ranking.SortHot}, []string{"2", "3", "5", "4", "1"}},
+		// только посты за сутки, по скорости набора рейтинга
+		{"rising", posts.FeedQuery{Sort: ranking.SortRising}, []string{"2", "3", "5"}},
+		{"controversial", posts.FeedQuery{Sort: ranking.SortControversial}, []string{"4", "3", "1", "5", "2"}},
+		{"limit", posts.FeedQuery{Sort: ranking.SortNew, Limit: 2}, []string{"3", "2"}},
+		{"category", posts.FeedQuery{Sort: ranking.SortHot, Category: "funny"}, []string{"3"}},
+		{"author", posts.FeedQuery{Sort: ranking.SortNew, Author: qwe.Login}, []string{"3", "4"}},
+	}
+	for _, c := range cases {
+		c.q.Now = now
+		res, err := repo.Feed(c.q)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.want, ids(res), c.name)
+	}
+
+	_, err := repo.Feed(posts.FeedQuery{Sort: "best"})
+	assert.True(t, errors.Is(err, ranking.ErrUnknownSort), "want ErrUnknownSort, got %v", err)
+}
+
+// testFeedPages листает каждую сортировку по две страницы вперед и обратно
+// и сверяет с лентой целиком
+func testFeedPages(t *testing.T, repo posts.PostRepo) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 1; i <= 7; i++ {
+		// у 2 и 3, 4 и 5, 6 и 7 одинаковые рейтинг и дата, порядок решает id
+		age := time.Duration(i/2) * time.Hour
+		mustAdd(t, repo, withVotes(NewPost(strconv.Itoa(i), "music", ata), now, age, 2+i/2, i%3))
+	}
+
+	sorts := []string{ranking.SortHot, ranking.SortTop, ranking.SortNew, ranking.SortRising, ranking.SortControversial}
+	for _, sort := range sorts {
+		whole, err := repo.Feed(posts.FeedQuery{Sort: sort, Now: now})
+		require.NoError(t, err, sort)
+
+		q := posts.FeedQuery{Sort: sort, Now: now, Limit: 2}
+		var forward []string
+		var last *posts.FeedPage
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 10, sort)
+			page, err := repo.FeedPage(q)
+			require.NoError(t, err, sort)
+			assert.Equal(t, q.After == nil, page.Prev == nil, "%s: prev only after first page", sort)
+			forward = append(forward, ids(page.Posts)...)
+			last = page
+			if page.Next == nil {
+				break
+			}
+			// курсор помнит момент расчета, now запроса уже не важен
+			q.After, q.Now = page.Next, now.Add(time.Hour)
+		}
+		assert.Equal(t, ids(whole), forward, sort)
+
+		var backward []string
+		page := last
+		for page.Prev != nil {
+			q.After, q.Before = nil, page.Prev
+			page, err = repo.FeedPage(q)
+			require.NoError(t, err, sort)
+			assert.NotNil(t, page.Next, sort)
+			backward = append(ids(page.Posts), backward...)
+		}
+		assert.Equal(t, forward, append(backward, ids(last.Posts)...), sort)
+	}
+
+	// новый пост наверху не сдвигает следующую страницу
+	q := posts.FeedQuery{Sort: ranking.SortNew, Now: now, Limit: 3}
+	page, err := repo.FeedPage(q)
+	require.NoError(t, err)
+	mustAdd(t, repo, withVotes(NewPost("8", "music", ata), now, 0, 1, 0))
+	q.After = page.Next
+	page, err = repo.FeedPage(q)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5", "4", "7"}, ids(page.Posts))
+
+	_, err = repo.FeedPage(posts.FeedQuery{Sort: ranking.SortHot, After: q.After})
+	assert.True(t, errors.Is(err, posts.ErrBadCursor), "cursor of another sort: %v", err)
+	_, err = repo.FeedPage(posts.FeedQuery{Sort: ranking.SortNew, After: q.After, Before: q.After})
+	assert.True(t, errors.Is(err, posts.ErrBadCursor), "both cursors: %v", err)
+}
+
+func testVotes(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	post, err := repo.GetByID("1")
+	require.NoError(t, err)
+
+	post = repo.IncreaseVote(&forms.VoteForm{ID: "2", Vote: 1}, post)
+	post = repo.IncreaseVote(&forms.VoteForm{ID: "3", Vote: -1}, post)
+	assert.Equal(t, 1, post.Score)
+	assert.Equal(t, uint32(66), post.UpVotedPercentage)
+
+	// повторный голос того же пользователя заменяет предыдущий
+	post = repo.IncreaseVote(&forms.VoteForm{ID: "3", Vote: 1}, post)
+	assert.Equal(t, 3, post.Score)
+	assert.Equal(t, uint32(100), post.UpVotedPercentage)
+	assert.Len(t, post.Votes, 3)
+
+	post = repo.DecreaseVote(&forms.VoteForm{ID: "2"}, post)
+	assert.Equal(t, 2, post.Score)
+	assert.Len(t, post.Votes, 2)
+
+	// отмена несуществующего голоса ничего не меняет
+	post = repo.DecreaseVote(&forms.VoteForm{ID: "42"}, post)
+	assert.Equal(t, 2, post.Score)
+
+	_, err = repo.Update(post)
+	require.NoError(t, err)
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Score)
+	assert.Equal(t, uint32(100), got.UpVotedPercentage)
+}
+
+func testApplyVote(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	post, err := repo.ApplyVote("1", qwe.ID, -1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, post.Score)
+	assert.Equal(t, uint32(50), post.UpVotedPercentage)
+	assert.Len(t, post.Votes, 2)
+
+	// повторный голос заменяет прежний, а не добавляется
+	post, err = repo.ApplyVote("1", qwe.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, post.Score)
+	assert.Equal(t, uint32(100), post.UpVotedPercentage)
+	assert.Len(t, post.Votes, 2)
+
+	post, err = repo.ApplyVote("1", qwe.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, post.Score)
+	assert.Len(t, post.Votes, 1)
+
+	post, err = repo.ApplyVote("1", ata.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, post.Score)
+	assert.Equal(t, uint32(0), post.UpVotedPercentage)
+	assert.Empty(t, post.Votes)
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Score)
+	assert.Empty(t, got.Votes)
+
+	_, err = repo.ApplyVote("1", qwe.ID, 2)
+	assert.True(t, errors.Is(err, posts.ErrBadVote), "want ErrBadVote, got %v", err)
+	_, err = repo.ApplyVote("42", qwe.ID, 1)
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+}
+
+func testConcurrentApplyVote(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	const n = 20
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := 1
+			if i%4 == 0 {
+				value = -1
+			}
+			if _, err := repo.ApplyVote("1", "voter"+strconv.Itoa(i), value); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 15 за, 5 против и голос автора - ни один голос не должен потеряться
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Len(t, got.Votes, n+1)
+	assert.Equal(t, 11, got.Score)
+	assert.Equal(t, uint32(16*100/21), got.UpVotedPercentage)
+}
+
+func testConcurrentViews(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	const n = 20
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.AddView("1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// ни один просмотр не должен потеряться
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(n), got.Views)
+
+	post, err := repo.AddView("1")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(n+1), post.Views)
+
+	_, err = repo.AddView("42")
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+	softDelete(t, repo, "1", created.Add(time.Hour))
+	_, err = repo.AddView("1")
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+}
+
+func testComments(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	// текст вида "$field" хранится как есть
+	for _, body := range []string{"first", "$title"} {
+		c := &comments.Comment{Description: body, CreatedBy: qwe, CreatedAt: created}
+		_, err := repo.AddComment("1", c)
+		require.NoError(t, err)
+		assert.NotEmpty(t, c.ID)
+	}
+	post, err := repo.GetByID("1")
+	require.NoError(t, err)
+	require.Len(t, post.Comments, 2)
+	assert.Equal(t, 2, post.ComCount)
+	assert.Equal(t, []string{"1", "2"}, []string{post.Comments[0].ID, post.Comments[1].ID})
+	assert.Equal(t, "$title", post.Comments[1].Description)
+	assert.True(t, created.Equal(post.Comments[1].CreatedAt), "created: %v", post.Comments[1].CreatedAt)
+
+	deleted := created.Add(time.Hour)
+	post, err = repo.SetCommentDeletion("1", "1", &deleted, &ata, "spam")
+	require.NoError(t, err)
+	require.True(t, post.Comments[0].Deleted())
+	assert.True(t, deleted.Equal(*post.Comments[0].DeletedAt))
+	assert.Equal(t, &ata, post.Comments[0].DeletedBy)
+	assert.Equal(t, "spam", post.Comments[0].DeleteReason)
+	assert.False(t, post.Comments[1].Deleted(), "other comments stay as they are")
+
+	post, err = repo.SetCommentDeletion("1", "1", nil, nil, "")
+	require.NoError(t, err)
+	assert.False(t, post.Comments[0].Deleted())
+	assert.Nil(t, post.Comments[0].DeletedBy)
+	assert.Equal(t, "first", post.Comments[0].Description)
+
+	_, err = repo.SetCommentDeletion("1", "42", &deleted, &ata, "")
+	assert.True(t, errors.Is(err, posts.ErrNoComment), "want ErrNoComment, got %v", err)
+	_, err = repo.SetCommentDeletion("42", "1", &deleted, &ata, "")
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+	_, err = repo.AddComment("42", &comments.Comment{Description: "x"})
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+
+	// к удаленному посту не комментируют
+	softDelete(t, repo, "1", deleted)
+	_, err = repo.AddComment("1", &comments.Comment{Description: "x"})
+	assert.True(t, errors.Is(err, posts.ErrNoPost), "want ErrNoPost, got %v", err)
+}
+
+func testConcurrentComments(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+	first := &comments.Comment{Description: "first", CreatedBy: qwe, CreatedAt: created}
+	_, err := repo.AddComment("1", first)
+	require.NoError(t, err)
+
+	const n = 20
+	deleted := created.Add(time.Hour)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i == n/2 {
+				_, err = repo.SetCommentDeletion("1", first.ID, &deleted, &qwe, "")
+			} else {
+				_, err = repo.AddComment("1", &comments.Comment{Description: "c" + strconv.Itoa(i), CreatedBy: qwe, CreatedAt: created})
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// ни добавление, ни удаление не должны потеряться, id не повторяются
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.Len(t, got.Comments, n)
+	assert.Equal(t, n, got.ComCount)
+	seen := map[string]bool{}
+	for _, c := range got.Comments {
+		assert.False(t, seen[c.ID], "duplicate comment id %s", c.ID)
+		seen[c.ID] = true
+	}
+	assert.True(t, got.Comments[0].Deleted())
+}
+
+func testConcurrentAdd(t *testing.T, repo posts.PostRepo) {
+	const n = 20
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := repo.Add(NewPost(strconv.Itoa(i+1), "music", ata)); err != nil {
+				errs <- fmt.Errorf("add %d: %w", i+1, err)
+			}
+			if _, err := repo.GetAll(); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	all, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, n)
+}
+
+func testConcurrentReadUpdate(t *testing.T, repo posts.PostRepo) {
+	mustAdd(t, repo, NewPost("1", "music", ata))
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			post, err := repo.GetByID("1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			post.Score = i
+			if _, err = repo.Update(post); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err := repo.GetByID("1")
+	require.NoError(t, err)
+	assert.True(t, got.Score >= 0 && got.Score < 10)
+}
@@ -0,0 +1,73 @@
+package posts
+
+import (
+	"redditclone/pkg/forms"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Revision - содержимое поста до правки: кто и когда его заменил и что было раньше
+type Revision struct {
+	PostID string `json:"postId" bson:"postId"`
+	// Number - порядковый номер правки поста, с 1
+	Number   int            `json:"number" bson:"number"`
+	EditedBy forms.UserForm `json:"editedBy" bson:"editedBy"`
+	EditedAt time.Time      `json:"edited" bson:"editedAt"`
+	Title    string         `json:"title" bson:"title"`
+	Text     string         `json:"text,omitempty" bson:"text,omitempty"`
+	URL      string         `json:"url,omitempty" bson:"url,omitempty"`
+}
+
+// RevisionRepo - история правок постов, отдельно от самих постов
+type RevisionRepo interface {
+	// Add сохраняет правку и проставляет ей следующий номер
+	Add(rev *Revision) error
+	// List - правки поста, последние первыми
+	List(postID string) ([]*Revision, error)
+	// Delete удаляет историю поста вместе с ним
+	Delete(postID string) error
+}
+
+// RevisionInMemoryRepository хранит историю в памяти процесса, как PostInMemoryRepository
+type RevisionInMemoryRepository struct {
+	data map[string][]*Revision
+	mu   *sync.RWMutex
+}
+
+func NewRevisionInMemoryRepo() *RevisionInMemoryRepository {
+	return &RevisionInMemoryRepository{
+		data: make(map[string][]*Revision),
+		mu:   &sync.RWMutex{},
+	}
+}
+
+func (repo *RevisionInMemoryRepository) Add(rev *Revision) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	rev.Number = len(repo.data[rev.PostID]) + 1
+	stored := *rev
+	repo.data[rev.PostID] = append(repo.data[rev.PostID], &stored)
+	return nil
+}
+
+func (repo *RevisionInMemoryRepository) List(postID string) ([]*Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	res := make([]*Revision, 0, len(repo.data[postID]))
+	for _, rev := range repo.data[postID] {
+		r := *rev
+		res = append(res, &r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Number > res[j].Number })
+	return res, nil
+}
+
+func (repo *RevisionInMemoryRepository) Delete(postID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.data, postID)
+	return nil
+}
@@ -0,0 +1,81 @@
+package posts
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// сколько раз Add пробует занять номер, если параллельная правка успела первой
+const revisionAddAttempts = 5
+
+// RevisionMongoRepository хранит историю в отдельной коллекции, по документу на правку.
+// Номер правки уникален в пределах поста, это держит индекс из EnsureIndexes
+type RevisionMongoRepository struct {
+	data *mongo.Collection
+}
+
+func NewRevisionMongoRepo(collection *mongo.Collection) *RevisionMongoRepository {
+	return &RevisionMongoRepository{
+		data: collection,
+	}
+}
+
+func (repo *RevisionMongoRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := repo.data.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "postId", Value: 1}, {Key: "number", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("create revision indexes: %w", err)
+	}
+	return nil
+}
+
+func (repo *RevisionMongoRepository) Add(rev *Revision) error {
+	for attempt := 0; attempt < revisionAddAttempts; attempt++ {
+		last := &Revision{}
+		err := repo.data.FindOne(context.TODO(),
+			bson.M{"postId": rev.PostID},
+			options.FindOne().SetSort(bson.D{{Key: "number", Value: -1}}),
+		).Decode(last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return fmt.Errorf("add revision: %w", err)
+		}
+		rev.Number = last.Number + 1
+
+		_, err = repo.data.InsertOne(context.TODO(), rev)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("add revision: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("add revision: post %s is edited concurrently", rev.PostID)
+}
+
+func (repo *RevisionMongoRepository) List(postID string) ([]*Revision, error) {
+	cur, err := repo.data.Find(context.TODO(),
+		bson.M{"postId": postID},
+		options.Find().SetSort(bson.D{{Key: "number", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	res := []*Revision{}
+	if err = cur.All(context.TODO(), &res); err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	return res, nil
+}
+
+func (repo *RevisionMongoRepository) Delete(postID string) error {
+	if _, err := repo.data.DeleteMany(context.TODO(), bson.M{"postId": postID}); err != nil {
+		return fmt.Errorf("delete revisions: %w", err)
+	}
+	return nil
+}
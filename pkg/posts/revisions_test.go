@@ -0,0 +1,40 @@
+package posts
+
+import (
+	"redditclone/pkg/forms"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevisionInMemoryRepo(t *testing.T) {
+	repo := NewRevisionInMemoryRepo()
+	editor := forms.UserForm{ID: "1", Login: "ata"}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, text := range []string{"first", "second", "third"} {
+		rev := &Revision{PostID: "1", EditedBy: editor, EditedAt: now.Add(time.Duration(i) * time.Minute), Title: "qwe", Text: text}
+		require.NoError(t, repo.Add(rev))
+		assert.Equal(t, i+1, rev.Number)
+	}
+	require.NoError(t, repo.Add(&Revision{PostID: "2", EditedBy: editor, EditedAt: now, URL: "https://privet.ru"}))
+
+	revs, err := repo.List("1")
+	require.NoError(t, err)
+	require.Len(t, revs, 3)
+	assert.Equal(t, []string{"third", "second", "first"}, []string{revs[0].Text, revs[1].Text, revs[2].Text})
+
+	// отдаются копии
+	revs[0].Text = "changed"
+	revs, _ = repo.List("1")
+	assert.Equal(t, "third", revs[0].Text)
+
+	require.NoError(t, repo.Delete("1"))
+	revs, err = repo.List("1")
+	require.NoError(t, err)
+	assert.Empty(t, revs)
+	revs, _ = repo.List("2")
+	assert.Len(t, revs, 1)
+}
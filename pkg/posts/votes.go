@@ -0,0 +1,121 @@
+package posts
+
+import (
+	"redditclone/pkg/forms"
+)
+
+// общая логика голосования для всех хранилищ постов
+
+// applyVote убирает прежний голос пользователя и, если value не 0, добавляет новый
+func applyVote(post *Post, userID string, value int) error {
+	if value < -1 || value > 1 {
+		return ErrBadVote
+	}
+
+	votes := make([]*forms.VoteForm, 0, len(post.Votes)+1)
+	for _, vote := range post.Votes {
+		if vote.ID != userID {
+			votes = append(votes, vote)
+		}
+	}
+	if value != 0 {
+		votes = append(votes, &forms.VoteForm{ID: userID, Vote: value})
+	}
+	post.Votes = votes
+
+	UpvotePercentage(post)
+	Score(post)
+	return nil
+}
+
+// IncreaseVote заменяет прежний голос пользователя на fd и пересчитывает рейтинг.
+// Пост без голосов не меняется
+func IncreaseVote(fd *forms.VoteForm, post *Post) *Post {
+	allnum := len(post.Votes)
+	if allnum == 0 {
+		return post
+	}
+
+	i := -1
+	for idx, vote := range post.Votes {
+		if vote.ID != fd.ID {
+			continue
+		}
+		i = idx
+	}
+
+	if i != -1 {
+		if i < len(post.Votes)-1 {
+			copy(post.Votes[i:], post.Votes[i+1:])
+		}
+		post.Votes[len(post.Votes)-1] = nil
+		post.Votes = post.Votes[:len(post.Votes)-1]
+	}
+
+	post.Votes = append(post.Votes, fd)
+
+	UpvotePercentage(post)
+	Score(post)
+	return post
+}
+
+// DecreaseVote убирает голос пользователя fd.ID, если он был
+func DecreaseVote(fd *forms.VoteForm, post *Post) *Post {
+	allnum := len(post.Votes)
+	if allnum == 0 {
+		return post
+	}
+
+	i := -1
+	for idx, vote := range post.Votes {
+		if vote.ID != fd.ID {
+			continue
+		}
+		i = idx
+	}
+
+	if i < 0 {
+		return post
+	}
+
+	if i < len(post.Votes)-1 {
+		copy(post.Votes[i:], post.Votes[i+1:])
+	}
+	post.Votes[len(post.Votes)-1] = nil
+	post.Votes = post.Votes[:len(post.Votes)-1]
+	UpvotePercentage(post)
+	Score(post)
+	return post
+}
+
+// UpvotePercentage пересчитывает долю положительных голосов в процентах
+func UpvotePercentage(post *Post) {
+	allnum := len(post.Votes)
+	if allnum == 0 {
+		post.UpVotedPercentage = 0
+		return
+	}
+
+	var currNums int
+	for _, vote := range post.Votes {
+		if vote.Vote == 1 {
+			currNums++
+		}
+	}
+	post.UpVotedPercentage = uint32(currNums * 100 / allnum)
+}
+
+// Score пересчитывает рейтинг - сумму голосов
+func Score(post *Post) {
+	allnum := len(post.Votes)
+	if allnum == 0 {
+		post.Score = 0
+		return
+	}
+
+	var currNums int
+	for _, vote := range post.Votes {
+		currNums += vote.Vote
+	}
+	post.Score = currNums
+}
@@ -0,0 +1,106 @@
+// Package ranking - порядок постов в ленте. Каждая стратегия считает ранг поста дважды:
+// в Go для хранилища в памяти и выражением агрегации для монги, чтобы сортировка и отбор
+// шли в базе и в память попадали только посты нужной страницы
+package ranking
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	SortHot           = "hot"
+	SortTop           = "top"
+	SortNew           = "new"
+	SortRising        = "rising"
+	SortControversial = "controversial"
+
+	// DefaultSort - без ?sort лента, как и раньше, идет по рейтингу за все время
+	DefaultSort = SortTop
+)
+
+var (
+	ErrUnknownSort   = errors.New(" unknown sort")
+	ErrUnknownWindow = errors.New(" unknown time window")
+)
+
+// Stats - то, от чего зависит ранг поста
+type Stats struct {
+	Score     int
+	Ups       int
+	Downs     int
+	CreatedAt time.Time
+}
+
+// Strategy - способ упорядочить ленту, больший ранг выше
+type Strategy interface {
+	Rank(s Stats, now time.Time) float64
+	// MongoRank - тот же ранг выражением агрегации. Поля поста доступны как переменные
+	// $$score, $$ups, $$downs и $$created (дата)
+	MongoRank(now time.Time) interface{}
+	// MaxAge - в ленту попадают только посты не старше, 0 - все
+	MaxAge() time.Duration
+}
+
+// Stored - стратегия, ранг которой монотонен по сохраненному полю поста. Монга сортирует
+// по этому полю и его индексу, не считая ранг для каждого поста
+type Stored interface {
+	// SortField - поле поста в монге, по убыванию которого идет лента
+	SortField() string
+}
+
+var (
+	mu         = &sync.RWMutex{}
+	strategies = map[string]Strategy{
+		SortHot:           Hot{},
+		SortTop:           Top{},
+		SortNew:           New{},
+		SortRising:        Rising{Window: 24 * time.Hour},
+		SortControversial: Controversial{},
+	}
+)
+
+// Register добавляет или заменяет стратегию name
+func Register(name string, s Strategy) {
+	mu.Lock()
+	defer mu.Unlock()
+	strategies[name] = s
+}
+
+// Get - стратегия по значению ?sort, пустое - DefaultSort
+func Get(name string) (Strategy, error) {
+	if name == "" {
+		name = DefaultSort
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSort, name)
+	}
+	return s, nil
+}
+
+// окна для ?t=, как у reddit
+var windows = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// ParseWindow - длительность окна ?t=, 0 - за все время
+func ParseWindow(t string) (time.Duration, error) {
+	if t == "" {
+		return 0, nil
+	}
+	d, ok := windows[t]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownWindow, t)
+	}
+	return d, nil
+}
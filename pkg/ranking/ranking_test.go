@@ -0,0 +1,97 @@
+package ranking
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHot(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := created.Add(time.Hour)
+
+	// рейтинг в 10 раз выше стоит 12.5 часов новизны
+	older := Hot{}.Rank(Stats{Score: 100, CreatedAt: created}, now)
+	newer := Hot{}.Rank(Stats{Score: 10, CreatedAt: created.Add(hotDecay * time.Second)}, now)
+	assert.InDelta(t, older, newer, 1e-9)
+
+	// отрицательный рейтинг опускает пост, от now ранг не зависит
+	neg := Hot{}.Rank(Stats{Score: -10, CreatedAt: created}, now)
+	zero := Hot{}.Rank(Stats{Score: 0, CreatedAt: created}, now)
+	assert.Less(t, neg, zero)
+	assert.Equal(t, zero, Hot{}.Rank(Stats{Score: 0, CreatedAt: created}, now.Add(time.Hour)))
+}
+
+func TestRising(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := Rising{Window: 24 * time.Hour}
+
+	assert.InDelta(t, 5.0/8, r.Rank(Stats{Score: 5, CreatedAt: now.Add(-2 * time.Hour)}, now), 1e-9)
+	// посты "из будущего" считаются только что созданными
+	assert.Equal(t,
+		r.Rank(Stats{Score: 5, CreatedAt: now}, now),
+		r.Rank(Stats{Score: 5, CreatedAt: now.Add(time.Hour)}, now))
+	assert.Equal(t, 24*time.Hour, r.MaxAge())
+}
+
+func TestControversial(t *testing.T) {
+	c := Controversial{}
+	assert.Equal(t, 0.0, c.Rank(Stats{Ups: 10}, time.Time{}))
+	assert.Equal(t, 0.0, c.Rank(Stats{Downs: 10}, time.Time{}))
+	assert.Equal(t, 40.0, c.Rank(Stats{Ups: 20, Downs: 20}, time.Time{}))
+	// при равном числе голосов выше тот, где они поделены ровнее
+	assert.Greater(t, c.Rank(Stats{Ups: 6, Downs: 4}, time.Time{}), c.Rank(Stats{Ups: 9, Downs: 1}, time.Time{}))
+	assert.Equal(t, c.Rank(Stats{Ups: 9, Downs: 1}, time.Time{}), c.Rank(Stats{Ups: 1, Downs: 9}, time.Time{}))
+}
+
+func TestTopNew(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 7.0, Top{}.Rank(Stats{Score: 7}, created))
+	assert.Less(t, New{}.Rank(Stats{CreatedAt: created}, created), New{}.Rank(Stats{CreatedAt: created.Add(time.Millisecond)}, created))
+
+	// top и new сортируются в монге по индексу, остальные - по вычисленному рангу
+	var s Strategy = Top{}
+	if stored, ok := s.(Stored); assert.True(t, ok) {
+		assert.Equal(t, "score", stored.SortField())
+	}
+	s = New{}
+	if stored, ok := s.(Stored); assert.True(t, ok) {
+		assert.Equal(t, "createdAt", stored.SortField())
+	}
+	for _, s := range []Strategy{Hot{}, Rising{}, Controversial{}} {
+		_, ok := s.(Stored)
+		assert.False(t, ok, "%T", s)
+	}
+}
+
+type constant float64
+
+func (c constant) Rank(Stats, time.Time) float64   { return float64(c) }
+func (c constant) MongoRank(time.Time) interface{} { return float64(c) }
+func (c constant) MaxAge() time.Duration           { return 0 }
+
+func TestRegistry(t *testing.T) {
+	s, err := Get("")
+	assert.NoError(t, err)
+	assert.Equal(t, Top{}, s)
+
+	_, err = Get("best")
+	assert.True(t, errors.Is(err, ErrUnknownSort))
+
+	Register("best", constant(1))
+	s, err = Get("best")
+	assert.NoError(t, err)
+	assert.Equal(t, constant(1), s)
+}
+
+func TestParseWindow(t *testing.T) {
+	for in, want := range map[string]time.Duration{"": 0, "all": 0, "hour": time.Hour, "week": 7 * 24 * time.Hour} {
+		d, err := ParseWindow(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, d, in)
+	}
+	_, err := ParseWindow("decade")
+	assert.True(t, errors.Is(err, ErrUnknownWindow))
+}
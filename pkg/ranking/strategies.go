@@ -0,0 +1,136 @@
+package ranking
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// hotEpoch и hotDecay - из формулы reddit: 45000 секунд (12.5 часа) новизны весят
+// столько же, сколько рост рейтинга в 10 раз
+const (
+	hotEpoch = 1134028003
+	hotDecay = 45000
+)
+
+// Hot - рейтинг по логарифму с поправкой на дату создания. От текущего времени не зависит:
+// свежие посты выше просто потому, что созданы позже
+type Hot struct{}
+
+func (Hot) Rank(s Stats, now time.Time) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(s.Score)), 1))
+	var sign float64
+	switch {
+	case s.Score > 0:
+		sign = 1
+	case s.Score < 0:
+		sign = -1
+	}
+	seconds := float64(s.CreatedAt.UnixMilli())/1000 - hotEpoch
+	return sign*order + seconds/hotDecay
+}
+
+func (Hot) MongoRank(now time.Time) interface{} {
+	return bson.M{"$add": bson.A{
+		bson.M{"$multiply": bson.A{
+			bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$$score", 0}}, 1,
+				bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$$score", 0}}, -1, 0}},
+			}},
+			bson.M{"$log10": bson.M{"$max": bson.A{bson.M{"$abs": "$$score"}, 1}}},
+		}},
+		bson.M{"$divide": bson.A{
+			bson.M{"$subtract": bson.A{
+				bson.M{"$divide": bson.A{bson.M{"$toLong": "$$created"}, 1000}},
+				hotEpoch,
+			}},
+			hotDecay,
+		}},
+	}}
+}
+
+func (Hot) MaxAge() time.Duration { return 0 }
+
+// Top - по рейтингу, окно задается через ?t=
+type Top struct{}
+
+func (Top) Rank(s Stats, now time.Time) float64 { return float64(s.Score) }
+
+func (Top) MongoRank(now time.Time) interface{} { return "$$score" }
+
+func (Top) MaxAge() time.Duration { return 0 }
+
+func (Top) SortField() string { return "score" }
+
+// New - сначала свежие
+type New struct{}
+
+func (New) Rank(s Stats, now time.Time) float64 { return float64(s.CreatedAt.UnixMilli()) }
+
+func (New) MongoRank(now time.Time) interface{} { return bson.M{"$toLong": "$$created"} }
+
+func (New) MaxAge() time.Duration { return 0 }
+
+func (New) SortField() string { return "createdAt" }
+
+// Rising - скорость набора рейтинга среди постов моложе Window: рейтинг делится на возраст
+// в часах со сдвигом и степенью, как в hacker news, чтобы старые посты быстро уступали новым
+type Rising struct {
+	Window time.Duration
+}
+
+const (
+	risingOffsetHours = 2
+	risingGravity     = 1.5
+)
+
+func (Rising) Rank(s Stats, now time.Time) float64 {
+	age := math.Max(now.Sub(s.CreatedAt).Hours(), 0)
+	return float64(s.Score) / math.Pow(age+risingOffsetHours, risingGravity)
+}
+
+func (Rising) MongoRank(now time.Time) interface{} {
+	ageHours := bson.M{"$max": bson.A{
+		bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, "$$created"}}, float64(time.Hour / time.Millisecond)}},
+		0,
+	}}
+	return bson.M{"$divide": bson.A{
+		"$$score",
+		bson.M{"$pow": bson.A{bson.M{"$add": bson.A{ageHours, risingOffsetHours}}, risingGravity}},
+	}}
+}
+
+func (r Rising) MaxAge() time.Duration { return r.Window }
+
+// Controversial - много голосов, поделенных поровну. Без голосов одной из сторон ранг 0
+type Controversial struct{}
+
+func (Controversial) Rank(s Stats, now time.Time) float64 {
+	if s.Ups <= 0 || s.Downs <= 0 {
+		return 0
+	}
+	magnitude := float64(s.Ups + s.Downs)
+	balance := float64(s.Ups) / float64(s.Downs)
+	if s.Ups > s.Downs {
+		balance = float64(s.Downs) / float64(s.Ups)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+func (Controversial) MongoRank(now time.Time) interface{} {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$or": bson.A{bson.M{"$lte": bson.A{"$$ups", 0}}, bson.M{"$lte": bson.A{"$$downs", 0}}}},
+		0,
+		bson.M{"$pow": bson.A{
+			bson.M{"$add": bson.A{"$$ups", "$$downs"}},
+			bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$$ups", "$$downs"}},
+				bson.M{"$divide": bson.A{"$$downs", "$$ups"}},
+				bson.M{"$divide": bson.A{"$$ups", "$$downs"}},
+			}},
+		}},
+	}}
+}
+
+func (Controversial) MaxAge() time.Duration { return 0 }
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// как часто выкидывать полные ведра и забытые неудачи, чтобы память не росла от перебора адресов
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   Rate
+}
+
+// refill досыпает попытки за время с последнего обращения
+func (b *bucket) refill(now time.Time) {
+	if b.rate.Every > 0 {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.rate.Every)
+	}
+	if max := float64(b.rate.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+}
+
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+	window      time.Duration
+}
+
+// MemoryStore хранит ведра в памяти процесса, годится для одного инстанса
+type MemoryStore struct {
+	buckets   map[string]*bucket
+	failures  map[string]*failures
+	mu        *sync.Mutex
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failures),
+		mu:       &sync.Mutex{},
+	}
+}
+
+func (s *MemoryStore) Take(key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), last: now}
+		s.buckets[key] = b
+	}
+	b.rate = rate
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) * float64(rate.Every)), nil
+}
+
+func (s *MemoryStore) Fail(key string, lockout Lockout, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok || now.Sub(f.last) > lockout.Window {
+		f = &failures{}
+		s.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	f.window = lockout.Window
+	d := lockout.duration(f.count)
+	if d > 0 {
+		f.lockedUntil = now.Add(d)
+	}
+	return d, nil
+}
+
+func (s *MemoryStore) LockedFor(key string, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok || !now.Before(f.lockedUntil) {
+		return 0, nil
+	}
+	return f.lockedUntil.Sub(now), nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep вызывается под мьютексом
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rate.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if !now.Before(f.lockedUntil) && now.Sub(f.last) > f.window {
+			delete(s.failures, key)
+		}
+	}
+}
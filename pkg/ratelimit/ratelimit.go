@@ -0,0 +1,146 @@
+// Package ratelimit ограничивает попытки входа и регистрации: ведро токенов на IP и на аккаунт
+// и временная блокировка аккаунта после серии неудач, каждая следующая вдвое длиннее
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrLimited = errors.New(" too many requests")
+
+// Rate - ведро на Burst попыток, которое пополняется на одну каждые Every
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+// Lockout - после Threshold неудач подряд аккаунт блокируется на Base, каждая следующая неудача
+// удваивает срок до Max. Неудачи старше Window забываются
+type Lockout struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// duration - срок блокировки после failures неудач, 0 - еще не блокируем
+func (l Lockout) duration(failures int) time.Duration {
+	if l.Threshold <= 0 || failures < l.Threshold {
+		return 0
+	}
+	d := l.Base
+	for i := l.Threshold; i < failures && d < l.Max; i++ {
+		d *= 2
+	}
+	if d > l.Max {
+		d = l.Max
+	}
+	return d
+}
+
+// Store хранит ведра и счетчики неудач. Сейчас в памяти процесса, при нескольких
+// инстансах его заменит общее хранилище с той же семантикой
+type Store interface {
+	// Take забирает попытку из ведра key. Если ведро пусто, возвращает false и через сколько появится попытка
+	Take(key string, rate Rate, now time.Time) (bool, time.Duration, error)
+	// Fail считает неудачу и возвращает, на сколько key теперь заблокирован, 0 - не заблокирован
+	Fail(key string, lockout Lockout, now time.Time) (time.Duration, error)
+	// LockedFor - сколько осталось до снятия блокировки key, 0 - не заблокирован
+	LockedFor(key string, now time.Time) (time.Duration, error)
+	// Reset забывает неудачи key после успешного входа
+	Reset(key string) error
+}
+
+// Guard применяет ограничения к запросам на вход и регистрацию
+type Guard struct {
+	Store      Store
+	PerIP      Rate
+	PerAccount Rate
+	Lockout    Lockout
+	// TrustForwarded - сервер за прокси, адрес клиента берется из X-Forwarded-For
+	TrustForwarded bool
+	now            func() time.Time
+}
+
+func NewGuard(store Store, perIP, perAccount Rate, lockout Lockout, trustForwarded bool) *Guard {
+	return &Guard{
+		Store:          store,
+		PerIP:          perIP,
+		PerAccount:     perAccount,
+		Lockout:        lockout,
+		TrustForwarded: trustForwarded,
+		now:            time.Now,
+	}
+}
+
+// Check - можно ли сделать попытку scope (login, register) с адреса запроса для аккаунта account.
+// Пустой account проверяет только IP. При отказе возвращает ErrLimited и через сколько повторить
+func (g *Guard) Check(r *http.Request, scope, account string) (time.Duration, error) {
+	now := g.now()
+	if account != "" {
+		locked, err := g.Store.LockedFor(accountKey(account), now)
+		if err != nil {
+			return 0, err
+		}
+		if locked > 0 {
+			return locked, ErrLimited
+		}
+	}
+
+	ok, retry, err := g.Store.Take(scope+":ip:"+g.clientIP(r), g.PerIP, now)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return retry, ErrLimited
+	}
+	if account == "" {
+		return 0, nil
+	}
+
+	ok, retry, err = g.Store.Take(scope+":account:"+strings.ToLower(account), g.PerAccount, now)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return retry, ErrLimited
+	}
+	return 0, nil
+}
+
+// Failed считает неудачный вход и возвращает срок блокировки аккаунта, если она началась
+func (g *Guard) Failed(account string) (time.Duration, error) {
+	return g.Store.Fail(accountKey(account), g.Lockout, g.now())
+}
+
+// Succeeded снимает счетчик неудач после верного пароля
+func (g *Guard) Succeeded(account string) error {
+	return g.Store.Reset(accountKey(account))
+}
+
+// логины сравниваем без регистра, чтобы Ayta и ayta не были разными счетчиками
+func accountKey(account string) string {
+	return "lockout:" + strings.ToLower(account)
+}
+
+// clientIP - адрес клиента. За прокси берем последний адрес из X-Forwarded-For:
+// его дописал наш прокси, а предыдущие клиент может подставить сам
+func (g *Guard) clientIP(r *http.Request) string {
+	if g.TrustForwarded {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket(t *testing.T) {
+	s := NewMemoryStore()
+	rate := Rate{Burst: 2, Every: 10 * time.Second}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := s.Take("k", rate, now)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, retry, _ := s.Take("k", rate, now)
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, retry)
+
+	// через 4 секунды попытки еще нет, ждать осталось 6
+	ok, retry, _ = s.Take("k", rate, now.Add(4*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 6*time.Second, retry)
+	ok, _, _ = s.Take("k", rate, now.Add(10*time.Second))
+	assert.True(t, ok)
+
+	// другие ключи не затронуты
+	ok, _, _ = s.Take("other", rate, now)
+	assert.True(t, ok)
+}
+
+func TestLockout(t *testing.T) {
+	s := NewMemoryStore()
+	lockout := Lockout{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute, Window: time.Hour}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// до порога не блокируем, дальше срок удваивается до Max
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		d, err := s.Fail("ayta", lockout, now)
+		assert.NoError(t, err)
+		assert.Equal(t, w, d, "failure %d", i+1)
+	}
+	locked, _ := s.LockedFor("ayta", now.Add(time.Minute))
+	assert.Equal(t, 4*time.Minute, locked)
+	locked, _ = s.LockedFor("ayta", now.Add(5*time.Minute))
+	assert.Equal(t, time.Duration(0), locked)
+
+	// успешный вход сбрасывает счетчик
+	assert.NoError(t, s.Reset("ayta"))
+	d, _ := s.Fail("ayta", lockout, now)
+	assert.Equal(t, time.Duration(0), d)
+
+	// неудачи старше окна забываются
+	s.Fail("qwe", lockout, now)
+	s.Fail("qwe", lockout, now)
+	d, _ = s.Fail("qwe", lockout, now.Add(2*time.Hour))
+	assert.Equal(t, time.Duration(0), d)
+}
+
+func TestSweep(t *testing.T) {
+	s := NewMemoryStore()
+	rate := Rate{Burst: 1, Every: time.Second}
+	lockout := Lockout{Threshold: 1, Base: time.Minute, Max: time.Minute, Window: time.Minute}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	s.Take("a", rate, now)
+	s.Fail("b", lockout, now)
+	s.Take("c", rate, now.Add(2*sweepInterval))
+	assert.Len(t, s.buckets, 1)
+	assert.Len(t, s.failures, 0)
+}
+
+func TestGuard(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGuard(NewMemoryStore(),
+		Rate{Burst: 3, Every: time.Minute},
+		Rate{Burst: 2, Every: time.Minute},
+		Lockout{Threshold: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour},
+		false,
+	)
+	g.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("POST", "/api/login", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	other := httptest.NewRequest("POST", "/api/login", nil)
+	other.RemoteAddr = "10.0.0.2:5555"
+
+	// аккаунт ограничен независимо от адреса
+	_, err := g.Check(req, "login", "ayta")
+	assert.NoError(t, err)
+	_, err = g.Check(other, "login", "Ayta")
+	assert.NoError(t, err)
+	retry, err := g.Check(other, "login", "ayta")
+	assert.Equal(t, ErrLimited, err)
+	assert.Equal(t, time.Minute, retry)
+
+	// адрес ограничен независимо от аккаунта
+	_, err = g.Check(req, "login", "qwe")
+	assert.NoError(t, err)
+	_, err = g.Check(req, "login", "rita")
+	assert.NoError(t, err)
+	_, err = g.Check(req, "login", "bob")
+	assert.Equal(t, ErrLimited, err)
+	// у регистрации свое ведро
+	_, err = g.Check(req, "register", "")
+	assert.NoError(t, err)
+
+	// блокировка аккаунта проверяется раньше ведер
+	now = now.Add(time.Hour)
+	d, _ := g.Failed("qwe")
+	assert.Equal(t, time.Duration(0), d)
+	d, _ = g.Failed("qwe")
+	assert.Equal(t, time.Minute, d)
+	retry, err = g.Check(other, "login", "qwe")
+	assert.Equal(t, ErrLimited, err)
+	assert.Equal(t, time.Minute, retry)
+
+	assert.NoError(t, g.Succeeded("qwe"))
+	_, err = g.Check(other, "login", "qwe")
+	assert.NoError(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/login", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+
+	g := &Guard{}
+	assert.Equal(t, "10.0.0.1", g.clientIP(req))
+	g.TrustForwarded = true
+	assert.Equal(t, "2.2.2.2", g.clientIP(req))
+}
@@ -0,0 +1,35 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Purger удаляет сессии и refresh-токены, истекшие к моменту now, и возвращает сколько удалено
+type Purger interface {
+	PurgeExpired(now time.Time) (int64, error)
+}
+
+// RunJanitor раз в interval чистит истекшие сессии и возвращается после отмены ctx
+func RunJanitor(ctx context.Context, p Purger, interval time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := p.PurgeExpired(now)
+			if err != nil {
+				logger.Errorw("cant purge expired sessions", "err", err)
+				continue
+			}
+			if n > 0 {
+				logger.Infow("purged expired sessions", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package session
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRunJanitor(t *testing.T) {
+	var calls int32
+	p := purgerFunc(func(now time.Time) (int64, error) {
+		atomic.AddInt32(&calls, 1)
+		return 1, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunJanitor(ctx, p, time.Millisecond, zap.NewNop().Sugar())
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not stop")
+	}
+	assert.True(t, atomic.LoadInt32(&calls) > 0)
+}
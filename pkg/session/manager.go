@@ -4,64 +4,80 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 )
 
+// SessionsManager хранит сессии в MySQL. Времена пишутся и читаются как time.Time,
+// поэтому в DSN нужен parseTime=true
 type SessionsManager struct {
-	data *sql.DB
-	mu   *sync.RWMutex
+	data     *sql.DB
+	lifetime Lifetime
+	now      func() time.Time
 }
 
-func NewSessionsManager(db *sql.DB) *SessionsManager {
+func NewSessionsManager(db *sql.DB, lifetime Lifetime) *SessionsManager {
 	return &SessionsManager{
-		data: db,
-		mu:   &sync.RWMutex{},
+		data:     db,
+		lifetime: lifetime,
+		now:      now,
 	}
 }
 
+// now - в базе DATETIME без долей секунды, округляем сразу, чтобы сравнения совпадали
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
 func (sm *SessionsManager) Check(r *http.Request) (*Session, error) {
 	sessionCookie, err := r.Cookie("session_id")
-	fmt.Println("ERRERER ", err)
 	if err == http.ErrNoCookie {
 		return nil, ErrNoAuth
 	}
 
 	s := &Session{}
-	sm.mu.RLock()
-	row := sm.data.QueryRow("SELECT id, userid FROM sessions WHERE id = ? LIMIT 1", sessionCookie.Value)
-	err = row.Scan(&s.ID, &s.UserID)
-	sm.mu.RUnlock()
-
+	row := sm.data.QueryRow(
+		"SELECT id, userid, created_at, last_seen, expires_at FROM sessions WHERE id = ? LIMIT 1",
+		sessionCookie.Value,
+	)
+	err = row.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.LastSeen, &s.ExpiresAt)
 	if err != nil {
 		return nil, ErrNoAuth
 	}
 
+	now := sm.now()
+	if s.Expired(now) {
+		return nil, ErrNoAuth
+	}
+	if sm.lifetime.touch(s, now) {
+		// не смогли продлить - сессия все равно еще действительна, попробуем в следующий раз
+		sm.data.Exec(
+			"UPDATE sessions SET last_seen = ?, expires_at = ? WHERE id = ?",
+			s.LastSeen,
+			s.ExpiresAt,
+			s.ID,
+		)
+	}
+
 	return s, nil
 }
 
 func (sm *SessionsManager) Create(w http.ResponseWriter, userID uint32, path string) (*Session, error) {
 	sess := NewSession(userID)
+	sm.lifetime.start(sess, sm.now())
 
-	sm.mu.Lock()
 	_, err := sm.data.Exec(
-		"INSERT INTO sessions (`id`, `userid`) VALUES (?, ?)",
+		"INSERT INTO sessions (`id`, `userid`, `created_at`, `last_seen`, `expires_at`) VALUES (?, ?, ?, ?, ?)",
 		sess.ID,
 		sess.UserID,
+		sess.CreatedAt,
+		sess.LastSeen,
+		sess.ExpiresAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("no user")
 	}
 
-	sm.mu.Unlock()
-
-	cookie := &http.Cookie{
-		Name:    "session_id",
-		Value:   sess.ID,
-		Expires: time.Now().Add(90 * 24 * time.Hour),
-		Path:    "/",
-	}
-	http.SetCookie(w, cookie)
+	http.SetCookie(w, sm.lifetime.cookie(sess))
 	return sess, nil
 }
 
@@ -71,7 +87,6 @@ func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request
 		return err
 	}
 
-	sm.mu.Lock()
 	_, err = sm.data.Exec(
 		"DELETE FROM sessions WHERE id = ?",
 		sess.ID,
@@ -80,13 +95,163 @@ func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request
 		return err
 	}
 
-	sm.mu.Unlock()
+	ExpireCookie(w)
+	return nil
+}
+
+func (sm *SessionsManager) ListByUser(userID uint32) ([]*Session, error) {
+	rows, err := sm.data.Query(
+		"SELECT id, userid, created_at, last_seen, expires_at FROM sessions WHERE userid = ? AND expires_at > ? ORDER BY created_at",
+		userID,
+		sm.now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	cookie := http.Cookie{
-		Name:    "session_id",
-		Expires: time.Now().AddDate(0, 0, -1),
-		Path:    "/",
+	res := []*Session{}
+	for rows.Next() {
+		s := &Session{}
+		if err = rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.LastSeen, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
 	}
-	http.SetCookie(w, &cookie)
-	return nil
+	return res, rows.Err()
+}
+
+func (sm *SessionsManager) DestroyByUser(userID uint32) (int64, error) {
+	res, err := sm.data.Exec("DELETE FROM sessions WHERE userid = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RevokeTokens - граница только растет, повторный отзыв с более ранним временем ее не откатит
+func (sm *SessionsManager) RevokeTokens(userID uint32, before time.Time) error {
+	_, err := sm.data.Exec(
+		"INSERT INTO token_revocations (`userid`, `revoked_before`) VALUES (?, ?) "+
+			"ON DUPLICATE KEY UPDATE `revoked_before` = GREATEST(`revoked_before`, VALUES(`revoked_before`))",
+		userID,
+		before.UTC().Truncate(time.Millisecond),
+	)
+	return err
+}
+
+func (sm *SessionsManager) TokensRevokedBefore(userID uint32) (time.Time, error) {
+	var before time.Time
+	row := sm.data.QueryRow("SELECT revoked_before FROM token_revocations WHERE userid = ?", userID)
+	err := row.Scan(&before)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return before, err
+}
+
+func (sm *SessionsManager) IssueRefresh(userID uint32, login string) (string, error) {
+	token, rt := newRefreshToken(userID, login, "", sm.lifetime, sm.now())
+	if err := sm.insertRefresh(rt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefresh гасит токен одним условным UPDATE, поэтому из двух параллельных обменов
+// одного токена успешен только один, а второй считается повторным предъявлением
+func (sm *SessionsManager) RotateRefresh(token string) (string, *RefreshToken, error) {
+	now := sm.now()
+	id := hashRefresh(token)
+
+	res, err := sm.data.Exec(
+		"UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?",
+		now,
+		id,
+		now,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", nil, err
+	}
+
+	rt := &RefreshToken{}
+	var usedAt sql.NullTime
+	row := sm.data.QueryRow(
+		"SELECT id, family, userid, login, created_at, expires_at, used_at FROM refresh_tokens WHERE id = ?",
+		id,
+	)
+	err = row.Scan(&rt.ID, &rt.Family, &rt.UserID, &rt.Login, &rt.CreatedAt, &rt.ExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return "", nil, ErrNoRefresh
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if n == 0 {
+		// гасить было нечего: токен уже использован или истек
+		rt.UsedAt = usedAt.Time
+		if err = checkRotate(rt, now); err == ErrRefreshReused {
+			sm.data.Exec("DELETE FROM refresh_tokens WHERE family = ?", rt.Family)
+		}
+		if err == nil {
+			err = ErrRefreshExpired
+		}
+		return "", nil, err
+	}
+
+	next, nextRT := newRefreshToken(rt.UserID, rt.Login, rt.Family, sm.lifetime, now)
+	if err = sm.insertRefresh(nextRT); err != nil {
+		return "", nil, err
+	}
+	return next, nextRT, nil
+}
+
+func (sm *SessionsManager) insertRefresh(rt *RefreshToken) error {
+	_, err := sm.data.Exec(
+		"INSERT INTO refresh_tokens (`id`, `family`, `userid`, `login`, `created_at`, `expires_at`) VALUES (?, ?, ?, ?, ?, ?)",
+		rt.ID,
+		rt.Family,
+		rt.UserID,
+		rt.Login,
+		rt.CreatedAt,
+		rt.ExpiresAt,
+	)
+	return err
+}
+
+func (sm *SessionsManager) RevokeRefresh(token string) error {
+	_, err := sm.data.Exec(
+		"DELETE t FROM refresh_tokens t JOIN refresh_tokens cur ON cur.family = t.family WHERE cur.id = ?",
+		hashRefresh(token),
+	)
+	return err
+}
+
+func (sm *SessionsManager) RevokeRefreshByUser(userID uint32) error {
+	_, err := sm.data.Exec("DELETE FROM refresh_tokens WHERE userid = ?", userID)
+	return err
+}
+
+func (sm *SessionsManager) PurgeExpired(now time.Time) (int64, error) {
+	res, err := sm.data.Exec("DELETE FROM sessions WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// погашенные токены держим до истечения, чтобы заметить их повторное предъявление
+	res, err = sm.data.Exec("DELETE FROM refresh_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return n, err
+	}
+	m, err := res.RowsAffected()
+	return n + m, err
 }
@@ -0,0 +1,277 @@
+package session
+
+import (
+	"net/http"
+	"redditclone/pkg/snapshot"
+	"sort"
+	"sync"
+	"time"
+)
+
+type sessionsSnapshot struct {
+	Sessions []*Session
+	Revoked  map[uint32]time.Time
+	Refresh  []*RefreshToken
+}
+
+// SessionsInMemoryManager хранит сессии в памяти процесса, без MySQL.
+// Если задан snapshotPath, сессии переживают рестарт
+type SessionsInMemoryManager struct {
+	data         map[string]*Session
+	revoked      map[uint32]time.Time
+	refresh      map[string]*RefreshToken
+	mu           *sync.RWMutex
+	lifetime     Lifetime
+	snapshotPath string
+	now          func() time.Time
+}
+
+func NewSessionsInMemoryManager(lifetime Lifetime, snapshotPath string) (*SessionsInMemoryManager, error) {
+	sm := &SessionsInMemoryManager{
+		data:         make(map[string]*Session),
+		revoked:      make(map[uint32]time.Time),
+		refresh:      make(map[string]*RefreshToken),
+		mu:           &sync.RWMutex{},
+		lifetime:     lifetime,
+		snapshotPath: snapshotPath,
+		now:          now,
+	}
+	if snapshotPath == "" {
+		return sm, nil
+	}
+
+	snap := &sessionsSnapshot{}
+	if err := snapshot.Load(snapshotPath, snap); err != nil {
+		return nil, err
+	}
+	for userID, before := range snap.Revoked {
+		sm.revoked[userID] = before
+	}
+	// истекшие, в том числе старые записи без expires_at, не поднимаем
+	now := sm.now()
+	for _, sess := range snap.Sessions {
+		if !sess.Expired(now) {
+			sm.data[sess.ID] = sess
+		}
+	}
+	for _, rt := range snap.Refresh {
+		if now.Before(rt.ExpiresAt) {
+			sm.refresh[rt.ID] = rt
+		}
+	}
+	return sm, nil
+}
+
+func (sm *SessionsInMemoryManager) Check(r *http.Request) (*Session, error) {
+	sessionCookie, err := r.Cookie("session_id")
+	if err == http.ErrNoCookie {
+		return nil, ErrNoAuth
+	}
+
+	now := sm.now()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sess, ok := sm.data[sessionCookie.Value]
+	if !ok || sess.Expired(now) {
+		return nil, ErrNoAuth
+	}
+	if sm.lifetime.touch(sess, now) {
+		// не смогли сохранить снимок - продление останется в памяти
+		sm.save()
+	}
+	res := *sess
+	return &res, nil
+}
+
+func (sm *SessionsInMemoryManager) Create(w http.ResponseWriter, userID uint32, path string) (*Session, error) {
+	sess := NewSession(userID)
+	sm.lifetime.start(sess, sm.now())
+
+	sm.mu.Lock()
+	sm.data[sess.ID] = sess
+	err := sm.save()
+	sm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, sm.lifetime.cookie(sess))
+	return sess, nil
+}
+
+func (sm *SessionsInMemoryManager) DestroyCurrent(w http.ResponseWriter, r *http.Request) error {
+	sess, err := SessionFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	delete(sm.data, sess.ID)
+	err = sm.save()
+	sm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ExpireCookie(w)
+	return nil
+}
+
+func (sm *SessionsInMemoryManager) ListByUser(userID uint32) ([]*Session, error) {
+	now := sm.now()
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	res := []*Session{}
+	for _, sess := range sm.data {
+		if sess.UserID == userID && !sess.Expired(now) {
+			s := *sess
+			res = append(res, &s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func (sm *SessionsInMemoryManager) DestroyByUser(userID uint32) (int64, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var n int64
+	for id, sess := range sm.data {
+		if sess.UserID == userID {
+			delete(sm.data, id)
+			n++
+		}
+	}
+	return n, sm.save()
+}
+
+func (sm *SessionsInMemoryManager) RevokeTokens(userID uint32, before time.Time) error {
+	before = before.UTC().Truncate(time.Millisecond)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if before.After(sm.revoked[userID]) {
+		sm.revoked[userID] = before
+	}
+	return sm.save()
+}
+
+func (sm *SessionsInMemoryManager) TokensRevokedBefore(userID uint32) (time.Time, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.revoked[userID], nil
+}
+
+func (sm *SessionsInMemoryManager) IssueRefresh(userID uint32, login string) (string, error) {
+	token, rt := newRefreshToken(userID, login, "", sm.lifetime, sm.now())
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.refresh[rt.ID] = rt
+	return token, sm.save()
+}
+
+func (sm *SessionsInMemoryManager) RotateRefresh(token string) (string, *RefreshToken, error) {
+	now := sm.now()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	rt, ok := sm.refresh[hashRefresh(token)]
+	if !ok {
+		return "", nil, ErrNoRefresh
+	}
+	switch err := checkRotate(rt, now); err {
+	case nil:
+	case ErrRefreshReused:
+		sm.deleteRefresh(func(other *RefreshToken) bool { return other.Family == rt.Family })
+		sm.save()
+		return "", nil, err
+	default:
+		return "", nil, err
+	}
+
+	rt.UsedAt = now
+	next, nextRT := newRefreshToken(rt.UserID, rt.Login, rt.Family, sm.lifetime, now)
+	sm.refresh[nextRT.ID] = nextRT
+	if err := sm.save(); err != nil {
+		return "", nil, err
+	}
+	res := *nextRT
+	return next, &res, nil
+}
+
+func (sm *SessionsInMemoryManager) RevokeRefresh(token string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	rt, ok := sm.refresh[hashRefresh(token)]
+	if !ok {
+		return nil
+	}
+	sm.deleteRefresh(func(other *RefreshToken) bool { return other.Family == rt.Family })
+	return sm.save()
+}
+
+func (sm *SessionsInMemoryManager) RevokeRefreshByUser(userID uint32) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.deleteRefresh(func(rt *RefreshToken) bool { return rt.UserID == userID })
+	return sm.save()
+}
+
+// deleteRefresh вызывается под мьютексом
+func (sm *SessionsInMemoryManager) deleteRefresh(match func(rt *RefreshToken) bool) int64 {
+	var n int64
+	for id, rt := range sm.refresh {
+		if match(rt) {
+			delete(sm.refresh, id)
+			n++
+		}
+	}
+	return n
+}
+
+func (sm *SessionsInMemoryManager) PurgeExpired(now time.Time) (int64, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var n int64
+	for id, sess := range sm.data {
+		if sess.Expired(now) {
+			delete(sm.data, id)
+			n++
+		}
+	}
+	// погашенные токены держим до истечения, чтобы заметить их повторное предъявление
+	n += sm.deleteRefresh(func(rt *RefreshToken) bool { return !now.Before(rt.ExpiresAt) })
+	if n == 0 {
+		return 0, nil
+	}
+	return n, sm.save()
+}
+
+// save вызывается под мьютексом
+func (sm *SessionsInMemoryManager) save() error {
+	if sm.snapshotPath == "" {
+		return nil
+	}
+	snap := &sessionsSnapshot{
+		Sessions: make([]*Session, 0, len(sm.data)),
+		Revoked:  sm.revoked,
+		Refresh:  make([]*RefreshToken, 0, len(sm.refresh)),
+	}
+	for _, sess := range sm.data {
+		snap.Sessions = append(snap.Sessions, sess)
+	}
+	for _, rt := range sm.refresh {
+		snap.Refresh = append(snap.Refresh, rt)
+	}
+	return snapshot.Save(sm.snapshotPath, snap)
+}
@@ -0,0 +1,199 @@
+package session
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	sm, err := NewSessionsInMemoryManager(Lifetime{Max: time.Hour}, path)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	sess, err := sm.Create(w, 2, "/api/login")
+	assert.NoError(t, err)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, sess.ID, cookies[0].Value)
+
+	req := httptest.NewRequest("GET", "/api/user/ayta", nil)
+	_, err = sm.Check(req)
+	assert.Equal(t, ErrNoAuth, err)
+
+	req.AddCookie(cookies[0])
+	got, err := sm.Check(req)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), got.UserID)
+
+	// сессия переживает рестарт
+	restored, err := NewSessionsInMemoryManager(Lifetime{Max: time.Hour}, path)
+	assert.NoError(t, err)
+	_, err = restored.Check(req)
+	assert.NoError(t, err)
+
+	req = req.WithContext(ContextWithSession(req.Context(), got))
+	assert.NoError(t, restored.DestroyCurrent(httptest.NewRecorder(), req))
+	_, err = restored.Check(req)
+	assert.Equal(t, ErrNoAuth, err)
+}
+
+func TestInMemoryManagerExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	sm, err := NewSessionsInMemoryManager(Lifetime{Max: 10 * time.Hour, Idle: time.Hour}, path)
+	assert.NoError(t, err)
+	clock := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	sm.now = func() time.Time { return clock }
+
+	w := httptest.NewRecorder()
+	sess, err := sm.Create(w, 2, "/api/login")
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Add(time.Hour), sess.ExpiresAt)
+	// кука живет до абсолютного конца сессии
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, clock.Add(10*time.Hour).Unix(), cookie.Expires.Unix())
+
+	req := httptest.NewRequest("GET", "/api/user/ayta", nil)
+	req.AddCookie(cookie)
+
+	// обращения продлевают сессию
+	for i := 0; i < 11; i++ {
+		clock = clock.Add(50 * time.Minute)
+		got, err := sm.Check(req)
+		assert.NoError(t, err)
+		assert.Equal(t, clock, got.LastSeen)
+	}
+	// но не дольше абсолютного срока
+	got, _ := sm.Check(req)
+	assert.Equal(t, sess.CreatedAt.Add(10*time.Hour), got.ExpiresAt)
+
+	clock = got.ExpiresAt
+	_, err = sm.Check(req)
+	assert.Equal(t, ErrNoAuth, err)
+
+	// чистильщик удаляет истекшие, в том числе из снимка
+	n, err := sm.PurgeExpired(clock)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	restored, err := NewSessionsInMemoryManager(Lifetime{Max: time.Hour}, path)
+	assert.NoError(t, err)
+	assert.Empty(t, restored.data)
+}
+
+func TestInMemoryManagerIdleTimeout(t *testing.T) {
+	sm, err := NewSessionsInMemoryManager(Lifetime{Max: 10 * time.Hour, Idle: time.Hour}, "")
+	assert.NoError(t, err)
+	clock := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	sm.now = func() time.Time { return clock }
+
+	w := httptest.NewRecorder()
+	_, err = sm.Create(w, 2, "/api/login")
+	assert.NoError(t, err)
+	req := httptest.NewRequest("GET", "/api/user/ayta", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+
+	clock = clock.Add(time.Hour)
+	_, err = sm.Check(req)
+	assert.Equal(t, ErrNoAuth, err)
+}
+
+func TestInMemoryManagerByUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	sm, err := NewSessionsInMemoryManager(Lifetime{Max: time.Hour}, path)
+	assert.NoError(t, err)
+	// реальное время: снимок при загрузке отбрасывает истекшие сессии
+	clock := now()
+	sm.now = func() time.Time { return clock }
+
+	first, _ := sm.Create(httptest.NewRecorder(), 2, "/api/login")
+	clock = clock.Add(time.Minute)
+	second, _ := sm.Create(httptest.NewRecorder(), 2, "/api/login")
+	other, _ := sm.Create(httptest.NewRecorder(), 3, "/api/login")
+
+	list, err := sm.ListByUser(2)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, first.ID, list[0].ID)
+	assert.Equal(t, second.ID, list[1].ID)
+
+	n, err := sm.DestroyByUser(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	list, _ = sm.ListByUser(2)
+	assert.Len(t, list, 0)
+	list, _ = sm.ListByUser(3)
+	assert.Equal(t, other.ID, list[0].ID)
+
+	before, _ := sm.TokensRevokedBefore(2)
+	assert.True(t, before.IsZero())
+	assert.NoError(t, sm.RevokeTokens(2, clock))
+	// более ранний отзыв границу не сдвигает
+	assert.NoError(t, sm.RevokeTokens(2, clock.Add(-time.Hour)))
+
+	// отзыв переживает рестарт
+	restored, err := NewSessionsInMemoryManager(Lifetime{Max: time.Hour}, path)
+	assert.NoError(t, err)
+	before, _ = restored.TokensRevokedBefore(2)
+	assert.Equal(t, clock, before)
+	list, _ = restored.ListByUser(3)
+	assert.Len(t, list, 1)
+}
+
+func TestInMemoryRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	lifetime := Lifetime{Max: time.Hour, Refresh: 24 * time.Hour}
+	sm, err := NewSessionsInMemoryManager(lifetime, path)
+	assert.NoError(t, err)
+	clock := now()
+	sm.now = func() time.Time { return clock }
+
+	first, err := sm.IssueRefresh(2, "ayta")
+	assert.NoError(t, err)
+
+	clock = clock.Add(time.Hour)
+	second, rt, err := sm.RotateRefresh(first)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, uint32(2), rt.UserID)
+	assert.Equal(t, "ayta", rt.Login)
+	// каждая ротация отсчитывает срок заново
+	assert.Equal(t, clock.Add(24*time.Hour), rt.ExpiresAt)
+
+	// цепочка переживает рестарт
+	sm, err = NewSessionsInMemoryManager(lifetime, path)
+	assert.NoError(t, err)
+	sm.now = func() time.Time { return clock }
+	third, _, err := sm.RotateRefresh(second)
+	assert.NoError(t, err)
+
+	// повторное предъявление погашенного токена отзывает всю цепочку
+	_, _, err = sm.RotateRefresh(second)
+	assert.Equal(t, ErrRefreshReused, err)
+	_, _, err = sm.RotateRefresh(third)
+	assert.Equal(t, ErrNoRefresh, err)
+
+	other, _ := sm.IssueRefresh(2, "ayta")
+	clock = clock.Add(25 * time.Hour)
+	_, _, err = sm.RotateRefresh(other)
+	assert.Equal(t, ErrRefreshExpired, err)
+	n, err := sm.PurgeExpired(clock)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// отзыв: по токену - его цепочка, по пользователю - все
+	a, _ := sm.IssueRefresh(2, "ayta")
+	b, _ := sm.IssueRefresh(2, "ayta")
+	c, _ := sm.IssueRefresh(3, "rita")
+	assert.NoError(t, sm.RevokeRefresh(a))
+	_, _, err = sm.RotateRefresh(a)
+	assert.Equal(t, ErrNoRefresh, err)
+	assert.NoError(t, sm.RevokeRefreshByUser(2))
+	_, _, err = sm.RotateRefresh(b)
+	assert.Equal(t, ErrNoRefresh, err)
+	_, _, err = sm.RotateRefresh(c)
+	assert.NoError(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 type MockSessionRepo struct {
@@ -45,7 +46,7 @@ func (m *MockSessionRepo) DestroyCurrent(w http.ResponseWriter, r *http.Request)
 	return ret0
 }
 
-func (mr *MockSessionRepoMockRecorder) DestroyCurrent(w http.ResponseWriter, r *http.Request) *gomock.Call {
+func (mr *MockSessionRepoMockRecorder) DestroyCurrent(w http.ResponseWriter, r interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyCurrent", reflect.TypeOf((*MockSessionRepo)(nil).DestroyCurrent), w, r)
 }
@@ -62,3 +63,54 @@ func (mr *MockSessionRepoMockRecorder) Create(w http.ResponseWriter, userID uint
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessionRepo)(nil).Create), w, userID, path)
 }
+
+func (m *MockSessionRepo) ListByUser(userID uint32) ([]*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByUser", userID)
+	ret0, _ := ret[0].([]*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockSessionRepoMockRecorder) ListByUser(userID uint32) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByUser", reflect.TypeOf((*MockSessionRepo)(nil).ListByUser), userID)
+}
+
+func (m *MockSessionRepo) DestroyByUser(userID uint32) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DestroyByUser", userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockSessionRepoMockRecorder) DestroyByUser(userID uint32) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyByUser", reflect.TypeOf((*MockSessionRepo)(nil).DestroyByUser), userID)
+}
+
+func (m *MockSessionRepo) RevokeTokens(userID uint32, before time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeTokens", userID, before)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (mr *MockSessionRepoMockRecorder) RevokeTokens(userID uint32, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeTokens", reflect.TypeOf((*MockSessionRepo)(nil).RevokeTokens), userID, before)
+}
+
+func (m *MockSessionRepo) TokensRevokedBefore(userID uint32) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TokensRevokedBefore", userID)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockSessionRepoMockRecorder) TokensRevokedBefore(userID uint32) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TokensRevokedBefore", reflect.TypeOf((*MockSessionRepo)(nil).TokensRevokedBefore), userID)
+}
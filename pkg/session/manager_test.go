@@ -0,0 +1,226 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestManagerCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	clock := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	sm := NewSessionsManager(db, Lifetime{Max: 10 * time.Hour, Idle: time.Hour})
+	sm.now = func() time.Time { return clock }
+
+	columns := []string{"id", "userid", "created_at", "last_seen", "expires_at"}
+	req := httptest.NewRequest("GET", "/api/user/ayta", nil)
+	_, err = sm.Check(req)
+	assert.Equal(t, ErrNoAuth, err)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "abc"})
+
+	// обращение меньше чем через минуту - без записи в базу
+	mock.ExpectQuery("SELECT id, userid, created_at, last_seen, expires_at FROM sessions WHERE").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("abc", 2, clock, clock, clock.Add(time.Hour)))
+	sess, err := sm.Check(req)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), sess.UserID)
+
+	// позже - сессия продлевается
+	clock = clock.Add(30 * time.Minute)
+	start := clock.Add(-30 * time.Minute)
+	mock.ExpectQuery("SELECT id, userid, created_at, last_seen, expires_at FROM sessions WHERE").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("abc", 2, start, start, start.Add(time.Hour)))
+	mock.ExpectExec("UPDATE sessions SET last_seen").
+		WithArgs(clock, clock.Add(time.Hour), "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sess, err = sm.Check(req)
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Add(time.Hour), sess.ExpiresAt)
+
+	// истекшая сессия
+	mock.ExpectQuery("SELECT id, userid, created_at, last_seen, expires_at FROM sessions WHERE").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("abc", 2, start, start, clock))
+	_, err = sm.Check(req)
+	assert.Equal(t, ErrNoAuth, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManagerCreateAndPurge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	clock := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	sm := NewSessionsManager(db, Lifetime{Max: 10 * time.Hour})
+	sm.now = func() time.Time { return clock }
+
+	mock.ExpectExec("INSERT INTO sessions").
+		WithArgs(sqlmock.AnyArg(), 2, clock, clock, clock.Add(10*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	w := httptest.NewRecorder()
+	sess, err := sm.Create(w, 2, "/api/login")
+	assert.NoError(t, err)
+	assert.Equal(t, sess.ID, w.Result().Cookies()[0].Value)
+
+	mock.ExpectExec("INSERT INTO sessions").WillReturnError(fmt.Errorf("bad query"))
+	_, err = sm.Create(httptest.NewRecorder(), 2, "/api/login")
+	assert.Error(t, err)
+
+	mock.ExpectExec("DELETE FROM sessions WHERE expires_at").
+		WithArgs(clock).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM refresh_tokens WHERE expires_at").
+		WithArgs(clock).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	n, err := sm.PurgeExpired(clock)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManagerByUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	clock := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	sm := NewSessionsManager(db, Lifetime{Max: 10 * time.Hour})
+	sm.now = func() time.Time { return clock }
+
+	rows := sqlmock.NewRows([]string{"id", "userid", "created_at", "last_seen", "expires_at"}).
+		AddRow("a", 2, clock, clock, clock.Add(time.Hour)).
+		AddRow("b", 2, clock, clock, clock.Add(2*time.Hour))
+	mock.ExpectQuery("SELECT id, userid, created_at, last_seen, expires_at FROM sessions WHERE userid").
+		WithArgs(2, clock).
+		WillReturnRows(rows)
+	list, err := sm.ListByUser(2)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "b", list[1].ID)
+
+	mock.ExpectExec("DELETE FROM sessions WHERE userid").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	n, err := sm.DestroyByUser(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	mock.ExpectExec("INSERT INTO token_revocations").
+		WithArgs(2, clock.Add(500*time.Millisecond)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, sm.RevokeTokens(2, clock.Add(500*time.Millisecond+300*time.Microsecond)))
+
+	mock.ExpectQuery("SELECT revoked_before FROM token_revocations").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked_before"}).AddRow(clock))
+	before, err := sm.TokensRevokedBefore(2)
+	assert.NoError(t, err)
+	assert.Equal(t, clock, before)
+
+	// отзывов не было
+	mock.ExpectQuery("SELECT revoked_before FROM token_revocations").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked_before"}))
+	before, err = sm.TokensRevokedBefore(3)
+	assert.NoError(t, err)
+	assert.True(t, before.IsZero())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManagerRefresh(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	clock := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	sm := NewSessionsManager(db, Lifetime{Max: time.Hour, Refresh: 24 * time.Hour})
+	sm.now = func() time.Time { return clock }
+	columns := []string{"id", "family", "userid", "login", "created_at", "expires_at", "used_at"}
+
+	mock.ExpectExec("INSERT INTO refresh_tokens").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 2, "ayta", clock, clock.Add(24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	token, err := sm.IssueRefresh(2, "ayta")
+	assert.NoError(t, err)
+	id := hashRefresh(token)
+
+	// обмен: гасим старый, выдаем следующий в той же цепочке
+	mock.ExpectExec("UPDATE refresh_tokens SET used_at").
+		WithArgs(clock, id, clock).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id, family, userid, login, created_at, expires_at, used_at FROM refresh_tokens").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(id, "fam", 2, "ayta", clock, clock.Add(24*time.Hour), clock))
+	mock.ExpectExec("INSERT INTO refresh_tokens").
+		WithArgs(sqlmock.AnyArg(), "fam", 2, "ayta", clock, clock.Add(24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	next, rt, err := sm.RotateRefresh(token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, next)
+	assert.Equal(t, "fam", rt.Family)
+
+	// уже погашен - отзываем цепочку
+	mock.ExpectExec("UPDATE refresh_tokens SET used_at").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id, family").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(id, "fam", 2, "ayta", clock, clock.Add(24*time.Hour), clock))
+	mock.ExpectExec("DELETE FROM refresh_tokens WHERE family").
+		WithArgs("fam").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	_, _, err = sm.RotateRefresh(token)
+	assert.Equal(t, ErrRefreshReused, err)
+
+	// истек
+	mock.ExpectExec("UPDATE refresh_tokens SET used_at").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id, family").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(id, "fam", 2, "ayta", clock, clock, nil))
+	_, _, err = sm.RotateRefresh(token)
+	assert.Equal(t, ErrRefreshExpired, err)
+
+	mock.ExpectExec("UPDATE refresh_tokens SET used_at").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id, family").
+		WillReturnRows(sqlmock.NewRows(columns))
+	_, _, err = sm.RotateRefresh("unknown")
+	assert.Equal(t, ErrNoRefresh, err)
+
+	mock.ExpectExec("DELETE t FROM refresh_tokens t").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(t, sm.RevokeRefresh(token))
+	mock.ExpectExec("DELETE FROM refresh_tokens WHERE userid").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(t, sm.RevokeRefreshByUser(2))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type purgerFunc func(now time.Time) (int64, error)
+
+func (f purgerFunc) PurgeExpired(now time.Time) (int64, error) {
+	return f(now)
+}
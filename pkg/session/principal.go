@@ -0,0 +1,38 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// Principal - пользователь, подтвердивший личность токеном. Его кладет в контекст middleware.Auth,
+// обработчики берут идентичность только отсюда и сами заголовки не разбирают
+type Principal struct {
+	UserID   uint32
+	Login    string
+	IssuedAt time.Time
+	// Role и Categories - из токена, правила доступа в пакете authz
+	Role       string
+	Categories []string
+	// Session - сессия из куки, если ее сверяли и она принадлежит тому же пользователю, иначе nil
+	Session *Session
+}
+
+type principalKey string
+
+var PrincipalKey principalKey = "principalKey"
+
+func PrincipalFromContext(ctx context.Context) (*Principal, error) {
+	p, ok := ctx.Value(PrincipalKey).(*Principal)
+	if !ok || p == nil {
+		return nil, ErrNoAuth
+	}
+	return p, nil
+}
+
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	if p.Session != nil {
+		ctx = ContextWithSession(ctx, p.Session)
+	}
+	return context.WithValue(ctx, PrincipalKey, p)
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoRefresh      = errors.New(" refresh token not found")
+	ErrRefreshExpired = errors.New(" refresh token expired")
+	// ErrRefreshReused - предъявлен уже погашенный токен, значит его украли или клиент
+	// сломался. Вся цепочка к этому моменту отозвана
+	ErrRefreshReused = errors.New(" refresh token reused")
+)
+
+// RefreshToken - запись о выданном refresh-токене. Сам токен не храним, только его sha256:
+// утечка таблицы не дает войти
+type RefreshToken struct {
+	// ID - sha256 токена
+	ID string
+	// Family - цепочка токенов от одного входа, ротация выдает следующий токен в той же цепочке
+	Family    string
+	UserID    uint32
+	Login     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// UsedAt - когда токен обменяли на следующий, нулевое - еще не использован
+	UsedAt time.Time
+}
+
+// RefreshRepo хранит долгоживущие refresh-токены, которыми клиент обновляет короткий access-токен
+type RefreshRepo interface {
+	// IssueRefresh начинает новую цепочку и возвращает токен для клиента
+	IssueRefresh(userID uint32, login string) (string, error)
+	// RotateRefresh гасит token и выдает следующий в той же цепочке
+	RotateRefresh(token string) (string, *RefreshToken, error)
+	// RevokeRefresh отзывает цепочку, к которой относится token
+	RevokeRefresh(token string) error
+	// RevokeRefreshByUser отзывает все refresh-токены пользователя
+	RevokeRefreshByUser(userID uint32) error
+}
+
+// newRefreshToken возвращает токен для клиента и запись о нем. family пустой - новая цепочка
+func newRefreshToken(userID uint32, login, family string, lifetime Lifetime, now time.Time) (string, *RefreshToken) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+	if family == "" {
+		family = hashRefresh(token)[:32]
+	}
+	return token, &RefreshToken{
+		ID:        hashRefresh(token),
+		Family:    family,
+		UserID:    userID,
+		Login:     login,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime.Refresh),
+	}
+}
+
+func hashRefresh(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkRotate решает, можно ли обменять rt
+func checkRotate(rt *RefreshToken, now time.Time) error {
+	switch {
+	case !rt.UsedAt.IsZero():
+		return ErrRefreshReused
+	case !now.Before(rt.ExpiresAt):
+		return ErrRefreshExpired
+	}
+	return nil
+}
@@ -6,11 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Session struct {
-	ID     string
-	UserID uint32
+	ID        string
+	UserID    uint32
+	CreatedAt time.Time
+	LastSeen  time.Time
+	ExpiresAt time.Time
 }
 
 func NewSession(userID uint32) *Session {
@@ -28,6 +32,62 @@ var (
 	ErrNoAuth = errors.New("No session found")
 )
 
+// Expired - сессия истекла к моменту now
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// чаще этого last_seen не обновляем, чтобы не писать в базу на каждый запрос
+const lastSeenResolution = time.Minute
+
+// Lifetime - сроки жизни сессии
+type Lifetime struct {
+	// Max - абсолютный срок от создания, столько же живет кука
+	Max time.Duration
+	// Idle - если больше 0, каждое обращение продлевает сессию на Idle, но не дольше Max
+	Idle time.Duration
+	// Refresh - срок жизни refresh-токена, каждая ротация отсчитывает его заново
+	Refresh time.Duration
+}
+
+// start заполняет времена новой сессии
+func (l Lifetime) start(sess *Session, now time.Time) {
+	sess.CreatedAt = now
+	sess.LastSeen = now
+	sess.ExpiresAt = l.expiresAt(sess, now)
+}
+
+// touch отмечает обращение к сессии, true - поля изменились и их нужно сохранить
+func (l Lifetime) touch(sess *Session, now time.Time) bool {
+	if now.Sub(sess.LastSeen) < lastSeenResolution {
+		return false
+	}
+	sess.LastSeen = now
+	sess.ExpiresAt = l.expiresAt(sess, now)
+	return true
+}
+
+func (l Lifetime) expiresAt(sess *Session, now time.Time) time.Time {
+	max := sess.CreatedAt.Add(l.Max)
+	if l.Idle <= 0 {
+		return max
+	}
+	if idle := now.Add(l.Idle); idle.Before(max) {
+		return idle
+	}
+	return max
+}
+
+// cookie живет до абсолютного конца сессии, продление ее не двигает
+func (l Lifetime) cookie(sess *Session) *http.Cookie {
+	return &http.Cookie{
+		Name:    "session_id",
+		Value:   sess.ID,
+		Expires: sess.CreatedAt.Add(l.Max),
+		Path:    "/",
+	}
+}
+
 type sessKey string
 
 var SessionKey sessKey = "sessionKey"
@@ -48,4 +108,22 @@ type SessionRepo interface {
 	Check(r *http.Request) (*Session, error)
 	Create(w http.ResponseWriter, userID uint32, path string) (*Session, error)
 	DestroyCurrent(w http.ResponseWriter, r *http.Request) error
+	// ListByUser возвращает действующие сессии пользователя
+	ListByUser(userID uint32) ([]*Session, error)
+	// DestroyByUser удаляет все сессии пользователя и возвращает сколько удалено
+	DestroyByUser(userID uint32) (int64, error)
+	// RevokeTokens делает недействительными все токены пользователя, выданные раньше before
+	RevokeTokens(userID uint32, before time.Time) error
+	// TokensRevokedBefore - граница отзыва токенов, нулевое время - ничего не отзывалось
+	TokensRevokedBefore(userID uint32) (time.Time, error)
+}
+
+// ExpireCookie удаляет куку сессии в браузере
+func ExpireCookie(w http.ResponseWriter) {
+	cookie := http.Cookie{
+		Name:    "session_id",
+		Expires: time.Now().AddDate(0, 0, -1),
+		Path:    "/",
+	}
+	http.SetCookie(w, &cookie)
 }
@@ -0,0 +1,51 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Save атомарно пишет v в файл как JSON: сначала во временный файл рядом, потом rename,
+// чтобы падение посреди записи не оставило битый снимок
+func Save(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("snapshot: marshal %s: %w", path, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("snapshot: create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("snapshot: write %s: %w", path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("snapshot: write %s: %w", path, err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("snapshot: rename %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load читает снимок в v. Отсутствие файла не ошибка - значит начинаем с пустого хранилища
+func Load(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot: read %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("snapshot: parse %s: %w", path, err)
+	}
+	return nil
+}
@@ -3,64 +3,182 @@ package user
 import (
 	"database/sql"
 	"errors"
-	"fmt"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/password"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 var (
-	ErrNoUser  = errors.New(" No user found")
-	ErrBadPass = errors.New(" Invald password")
+	ErrNoUser       = errors.New(" No user found")
+	ErrBadPass      = errors.New(" Invald password")
+	ErrUserDisabled = errors.New(" User disabled")
 )
 
-type UsersMemoryRepository struct {
-	data   *sql.DB
-	LastID uint32
+// код ошибки MySQL при нарушении уникального ключа
+const errDuplicateEntry = 1062
+
+const userColumns = "id, login, password, role, categories, disabled"
+
+// категории модератора хранятся в одной колонке через запятую, их немного и они из фиксированного списка
+func joinCategories(categories []string) string {
+	return strings.Join(categories, ",")
+}
+
+func splitCategories(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// rowScanner - *sql.Row или *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	u := &User{}
+	var categories string
+	err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Role, &categories, &u.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	u.Categories = splitCategories(categories)
+	return u, nil
 }
 
-func (repo *UsersMemoryRepository) NewUserID() uint32 {
-	repo.LastID++
-	return repo.LastID
+type UsersMemoryRepository struct {
+	data   *sql.DB
+	hasher password.Hasher
 }
 
-func NewMemoryRepo(db *sql.DB) *UsersMemoryRepository {
+func NewMemoryRepo(db *sql.DB, hasher password.Hasher) *UsersMemoryRepository {
 	return &UsersMemoryRepository{
 		data:   db,
-		LastID: 1,
+		hasher: hasher,
 	}
 }
 
 func (repo *UsersMemoryRepository) FindUser(login string) (*User, error) {
-	u := &User{}
-	row := repo.data.QueryRow("SELECT id, login, password FROM users WHERE login = ?", login)
-	err := row.Scan(&u.ID, &u.Login, &u.Password)
+	u, err := scanUser(repo.data.QueryRow("SELECT "+userColumns+" FROM users WHERE login = ?", login))
 	if err != nil {
 		return nil, ErrNoUser
 	}
 	return u, nil
 }
 
+func (repo *UsersMemoryRepository) GetByID(id uint32) (*User, error) {
+	u, err := scanUser(repo.data.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (repo *UsersMemoryRepository) List() ([]*User, error) {
+	rows, err := repo.data.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []*User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	return res, rows.Err()
+}
+
+func (repo *UsersMemoryRepository) SetRole(id uint32, role string, categories []string) (*User, error) {
+	_, err := repo.data.Exec(
+		"UPDATE users SET `role` = ?, `categories` = ? WHERE id = ?",
+		role,
+		joinCategories(categories),
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// RowsAffected не отличает "нет строки" от "значение не изменилось", поэтому перечитываем
+	return repo.GetByID(id)
+}
+
+func (repo *UsersMemoryRepository) SetDisabled(id uint32, disabled bool) (*User, error) {
+	_, err := repo.data.Exec("UPDATE users SET `disabled` = ? WHERE id = ?", disabled, id)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetByID(id)
+}
+
 func (repo *UsersMemoryRepository) Authorize(login, pass string) (*User, error) {
-	u := &User{}
-	row := repo.data.QueryRow("SELECT id, login, password FROM users WHERE login = ?", login)
-	err := row.Scan(&u.ID, &u.Login, &u.Password)
-	fmt.Println("row ", row)
+	u, err := scanUser(repo.data.QueryRow("SELECT "+userColumns+" FROM users WHERE login = ?", login))
 	if err != nil {
+		// тратим то же время, что и на проверку, чтобы по задержке нельзя было перебирать логины
+		repo.hasher.Hash(pass)
 		return nil, ErrNoUser
 	}
 
-	if u.Password != pass {
+	ok, rehash, err := repo.hasher.Verify(u.Password, pass)
+	if err != nil || !ok {
 		return nil, ErrBadPass
 	}
+	// о блокировке говорим только тому, кто знает пароль
+	if u.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	// старый пароль открытым текстом или устаревший хеш: перехешируем, пока знаем пароль.
+	// Если не вышло, вход не ломаем - попробуем при следующем
+	if rehash {
+		hash, err := repo.hasher.Hash(pass)
+		if err == nil {
+			_, err = repo.data.Exec("UPDATE users SET `password` = ? WHERE id = ?", hash, u.ID)
+		}
+		if err == nil {
+			u.Password = hash
+		}
+	}
 
 	return u, nil
 }
 
-func (repo *UsersMemoryRepository) Add(u *User) error {
-
-	_, err := repo.data.Exec(
-		"INSERT INTO users (`login`, `password`, `ID`) VALUES (?, ?, ?)",
+// Add - id выдает AUTO_INCREMENT, поэтому он уникален и не повторяется после рестарта
+func (repo *UsersMemoryRepository) Add(u *User) (*User, error) {
+	hash, err := repo.hasher.Hash(u.Password)
+	if err != nil {
+		return nil, err
+	}
+	res, err := repo.data.Exec(
+		"INSERT INTO users (`login`, `password`) VALUES (?, ?)",
 		u.Login,
-		u.Password,
-		repo.NewUserID(),
+		hash,
 	)
-	return err
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:       uint32(id),
+		Login:    u.Login,
+		Password: hash,
+		Role:     authz.RoleUser,
+	}, nil
 }
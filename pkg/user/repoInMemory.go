@@ -0,0 +1,214 @@
+package user
+
+import (
+	"errors"
+	"redditclone/pkg/authz"
+	"redditclone/pkg/password"
+	"redditclone/pkg/snapshot"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUserExists = errors.New(" User already exists")
+)
+
+// UsersInMemoryRepository хранит пользователей в памяти процесса, без MySQL.
+// Если задан snapshotPath, после каждого изменения состояние сбрасывается на диск
+// и поднимается обратно при старте
+type UsersInMemoryRepository struct {
+	data         map[string]*User
+	mu           *sync.RWMutex
+	snapshotPath string
+	hasher       password.Hasher
+	LastID       uint32
+}
+
+type usersSnapshot struct {
+	LastID uint32
+	Users  []*User
+}
+
+func NewInMemoryRepo(snapshotPath string, hasher password.Hasher) (*UsersInMemoryRepository, error) {
+	repo := &UsersInMemoryRepository{
+		data:         make(map[string]*User),
+		mu:           &sync.RWMutex{},
+		snapshotPath: snapshotPath,
+		hasher:       hasher,
+		LastID:       0,
+	}
+	if snapshotPath == "" {
+		return repo, nil
+	}
+
+	snap := &usersSnapshot{}
+	if err := snapshot.Load(snapshotPath, snap); err != nil {
+		return nil, err
+	}
+	for _, u := range snap.Users {
+		repo.data[u.Login] = u
+	}
+	if snap.LastID > repo.LastID {
+		repo.LastID = snap.LastID
+	}
+	return repo, nil
+}
+
+func (repo *UsersInMemoryRepository) FindUser(login string) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	u, ok := repo.data[login]
+	if !ok {
+		return nil, ErrNoUser
+	}
+	res := *u
+	return &res, nil
+}
+
+func (repo *UsersInMemoryRepository) GetByID(id uint32) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	u := repo.byID(id)
+	if u == nil {
+		return nil, ErrNoUser
+	}
+	res := *u
+	return &res, nil
+}
+
+func (repo *UsersInMemoryRepository) List() ([]*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	res := make([]*User, 0, len(repo.data))
+	for _, u := range repo.data {
+		cp := *u
+		res = append(res, &cp)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (repo *UsersInMemoryRepository) SetRole(id uint32, role string, categories []string) (*User, error) {
+	return repo.update(id, func(u *User) {
+		u.Role = role
+		u.Categories = append([]string(nil), categories...)
+	})
+}
+
+func (repo *UsersInMemoryRepository) SetDisabled(id uint32, disabled bool) (*User, error) {
+	return repo.update(id, func(u *User) {
+		u.Disabled = disabled
+	})
+}
+
+func (repo *UsersInMemoryRepository) update(id uint32, change func(u *User)) (*User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	u := repo.byID(id)
+	if u == nil {
+		return nil, ErrNoUser
+	}
+	change(u)
+	if err := repo.save(); err != nil {
+		return nil, err
+	}
+	res := *u
+	return &res, nil
+}
+
+// byID вызывается под мьютексом. Пользователей немного, поэтому отдельный индекс по id не держим
+func (repo *UsersInMemoryRepository) byID(id uint32) *User {
+	for _, u := range repo.data {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func (repo *UsersInMemoryRepository) Authorize(login, pass string) (*User, error) {
+	u, err := repo.FindUser(login)
+	if err != nil {
+		repo.hasher.Hash(pass)
+		return nil, err
+	}
+
+	ok, rehash, err := repo.hasher.Verify(u.Password, pass)
+	if err != nil || !ok {
+		return nil, ErrBadPass
+	}
+	// о блокировке говорим только тому, кто знает пароль
+	if u.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if !rehash {
+		return u, nil
+	}
+
+	hash, err := repo.hasher.Hash(pass)
+	if err != nil {
+		return u, nil
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, ok := repo.data[login]
+	if !ok {
+		return u, nil
+	}
+	stored.Password = hash
+	if err = repo.save(); err != nil {
+		return u, nil
+	}
+	u.Password = hash
+	return u, nil
+}
+
+func (repo *UsersInMemoryRepository) Add(u *User) (*User, error) {
+	// хеширование медленное, делаем его до блокировки
+	hash, err := repo.hasher.Hash(u.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.data[u.Login]; exists {
+		return nil, ErrUserExists
+	}
+
+	repo.LastID++
+	stored := *u
+	stored.ID = repo.LastID
+	stored.Password = hash
+	if stored.Role == "" {
+		stored.Role = authz.RoleUser
+	}
+	repo.data[u.Login] = &stored
+	if err := repo.save(); err != nil {
+		return nil, err
+	}
+	res := stored
+	return &res, nil
+}
+
+// save вызывается под мьютексом
+func (repo *UsersInMemoryRepository) save() error {
+	if repo.snapshotPath == "" {
+		return nil
+	}
+	snap := &usersSnapshot{
+		LastID: repo.LastID,
+		Users:  make([]*User, 0, len(repo.data)),
+	}
+	for _, u := range repo.data {
+		snap.Users = append(snap.Users, u)
+	}
+	return snapshot.Save(repo.snapshotPath, snap)
+}
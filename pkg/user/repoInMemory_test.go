@@ -0,0 +1,115 @@
+package user
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryRepo(t *testing.T) {
+	repo, err := NewInMemoryRepo("", testHasher)
+	assert.NoError(t, err)
+
+	_, err = repo.FindUser("ayta")
+	assert.Equal(t, ErrNoUser, err)
+
+	added, err := repo.Add(&User{ID: 5, Login: "ayta", Password: "12345678"})
+	assert.NoError(t, err)
+	// id выдает хранилище, переданный игнорируется, пароль хранится только хешем
+	assert.Equal(t, uint32(1), added.ID)
+	assert.NotEqual(t, "12345678", added.Password)
+	_, err = repo.Add(&User{Login: "ayta", Password: "qwerty"})
+	assert.Equal(t, ErrUserExists, err)
+
+	u, err := repo.Authorize("ayta", "12345678")
+	assert.NoError(t, err)
+	assert.Equal(t, added, u)
+
+	_, err = repo.Authorize("ayta", "1234567")
+	assert.Equal(t, ErrBadPass, err)
+	_, err = repo.Authorize("aya", "12345678")
+	assert.Equal(t, ErrNoUser, err)
+
+	added, err = repo.Add(&User{Login: "qwe", Password: "123"})
+	assert.NoError(t, err)
+	u, _ = repo.FindUser("qwe")
+	assert.Equal(t, uint32(2), u.ID)
+	assert.Equal(t, added, u)
+}
+
+func TestInMemoryRepoSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+
+	repo, err := NewInMemoryRepo(path, testHasher)
+	assert.NoError(t, err)
+	added, err := repo.Add(&User{Login: "ayta", Password: "12345678"})
+	assert.NoError(t, err)
+	id := added.ID
+
+	restored, err := NewInMemoryRepo(path, testHasher)
+	assert.NoError(t, err)
+	u, err := restored.FindUser("ayta")
+	assert.NoError(t, err)
+	assert.Equal(t, id, u.ID)
+
+	// после рестарта id не переиспользуются
+	added, err = restored.Add(&User{Login: "qwe", Password: "123"})
+	assert.NoError(t, err)
+	assert.True(t, added.ID > id)
+}
+
+func TestInMemoryRepoRehash(t *testing.T) {
+	repo, err := NewInMemoryRepo("", testHasher)
+	assert.NoError(t, err)
+	// запись из старого снимка, пароль открытым текстом
+	repo.data["ayta"] = &User{ID: 1, Login: "ayta", Password: "12345678"}
+
+	_, err = repo.Authorize("ayta", "1234567")
+	assert.Equal(t, ErrBadPass, err)
+	assert.Equal(t, "12345678", repo.data["ayta"].Password)
+
+	u, err := repo.Authorize("ayta", "12345678")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "12345678", repo.data["ayta"].Password)
+	assert.Equal(t, repo.data["ayta"].Password, u.Password)
+
+	_, err = repo.Authorize("ayta", "12345678")
+	assert.NoError(t, err)
+}
+
+func TestInMemoryRepoAdmin(t *testing.T) {
+	repo, err := NewInMemoryRepo("", testHasher)
+	assert.NoError(t, err)
+	first, _ := repo.Add(&User{Login: "ayta", Password: "12345678"})
+	second, _ := repo.Add(&User{Login: "qwe", Password: "12345678"})
+	assert.Equal(t, "user", first.Role)
+
+	u, err := repo.SetRole(second.ID, "moderator", []string{"music"})
+	assert.NoError(t, err)
+	assert.Equal(t, "moderator", u.Role)
+	assert.Equal(t, []string{"music"}, u.Categories)
+	_, err = repo.SetRole(42, "admin", nil)
+	assert.Equal(t, ErrNoUser, err)
+
+	u, err = repo.SetDisabled(second.ID, true)
+	assert.NoError(t, err)
+	assert.True(t, u.Disabled)
+	_, err = repo.Authorize("qwe", "12345678")
+	assert.Equal(t, ErrUserDisabled, err)
+	// неверный пароль не выдает факт блокировки
+	_, err = repo.Authorize("qwe", "1234567")
+	assert.Equal(t, ErrBadPass, err)
+
+	list, err := repo.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, first.ID, list[0].ID)
+	assert.Equal(t, second.ID, list[1].ID)
+
+	u, err = repo.GetByID(second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "qwe", u.Login)
+	_, err = repo.GetByID(42)
+	assert.Equal(t, ErrNoUser, err)
+}
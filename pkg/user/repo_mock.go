@@ -24,18 +24,6 @@ func (m *MockUserRepo) EXPECT() *MockUserRepoMockRecorder {
 	return m.recorder
 }
 
-func (m *MockUserRepo) NewUserID() uint32 {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewUserID")
-	ret0, _ := ret[0].(uint32)
-	return ret0
-}
-
-func (mr *MockUserRepoMockRecorder) NewUserID() *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewUserID", reflect.TypeOf((*MockUserRepo)(nil).NewUserID))
-}
-
 func (m *MockUserRepo) FindUser(login string) (*User, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "FindUser", login)
@@ -49,11 +37,12 @@ func (mr *MockUserRepoMockRecorder) FindUser(login string) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUser", reflect.TypeOf((*MockUserRepo)(nil).FindUser), login)
 }
 
-func (m *MockUserRepo) Add(arg0 *User) error {
+func (m *MockUserRepo) Add(arg0 *User) (*User, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Add", arg0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 func (mr *MockUserRepoMockRecorder) Add(arg0 interface{}) *gomock.Call {
@@ -73,3 +62,55 @@ func (mr *MockUserRepoMockRecorder) Authorize(arg0 interface{}, arg1 interface{}
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockUserRepo)(nil).Authorize), arg0, arg1)
 }
+
+func (m *MockUserRepo) GetByID(id uint32) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", id)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockUserRepoMockRecorder) GetByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockUserRepo)(nil).GetByID), id)
+}
+
+func (m *MockUserRepo) List() ([]*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockUserRepoMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockUserRepo)(nil).List))
+}
+
+func (m *MockUserRepo) SetRole(id uint32, role string, categories []string) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRole", id, role, categories)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockUserRepoMockRecorder) SetRole(id, role, categories interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRole", reflect.TypeOf((*MockUserRepo)(nil).SetRole), id, role, categories)
+}
+
+func (m *MockUserRepo) SetDisabled(id uint32, disabled bool) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDisabled", id, disabled)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockUserRepoMockRecorder) SetDisabled(id, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDisabled", reflect.TypeOf((*MockUserRepo)(nil).SetDisabled), id, disabled)
+}
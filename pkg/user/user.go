@@ -4,11 +4,24 @@ type User struct {
 	ID       uint32
 	Login    string
 	Password string
+	// Role - authz.RoleUser, RoleModerator или RoleAdmin
+	Role string
+	// Categories - где модератор управляет контентом, для остальных ролей пусто
+	Categories []string
+	// Disabled - вход запрещен, заблокировать может админ
+	Disabled bool
 }
 
 type UsersRepo interface {
 	FindUser(login string) (*User, error)
+	GetByID(id uint32) (*User, error)
+	// Authorize проверяет пароль. Заблокированному пользователю с верным паролем возвращает ErrUserDisabled
 	Authorize(login, pass string) (*User, error)
-	NewUserID() uint32
-	Add(u *User) error
+	// Add сохраняет пользователя и возвращает его с id, который выдало хранилище.
+	// Если логин занят, возвращает ErrUserExists
+	Add(u *User) (*User, error)
+	// List - все пользователи по возрастанию id
+	List() ([]*User, error)
+	SetRole(id uint32, role string, categories []string) (*User, error)
+	SetDisabled(id uint32, disabled bool) (*User, error)
 }
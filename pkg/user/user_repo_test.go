@@ -5,11 +5,19 @@ import (
 	"reflect"
 	"testing"
 
+	"redditclone/pkg/password"
+
+	"github.com/go-sql-driver/mysql"
 	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
 // go test -coverprofile=cover.out && go tool cover -html=cover.out -o cover.html
 
+// минимальная стоимость bcrypt, чтобы тесты шли быстро
+var testHasher = password.NewBcrypt(4)
+
+var userRowColumns = []string{"id", "login", "password", "role", "categories", "disabled"}
+
 func TestAdd(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -17,7 +25,8 @@ func TestAdd(t *testing.T) {
 	}
 	defer db.Close()
 	repo := &UsersMemoryRepository{
-		data: db,
+		data:   db,
+		hasher: testHasher,
 	}
 
 	login := "12"
@@ -25,32 +34,51 @@ func TestAdd(t *testing.T) {
 	testItem := &User{
 		Login:    login,
 		Password: password,
-		ID:       1,
 	}
 
-	//ok query
+	//ok query, id выдает база, в базу уходит только хеш
 	mock.
 		ExpectExec(`INSERT INTO users`).
-		WithArgs(login, password, 1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WithArgs(login, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
 
-	err = repo.Add(testItem)
+	added, err := repo.Add(testItem)
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
 	}
+	if added.ID != 7 || added.Login != login || added.Password == password {
+		t.Errorf("results not match, have %v", added)
+		return
+	}
+	if ok, _, _ := testHasher.Verify(added.Password, password); !ok {
+		t.Errorf("stored hash does not match password")
+		return
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 
+	// login already exists
+	mock.
+		ExpectExec(`INSERT INTO users`).
+		WithArgs(login, sqlmock.AnyArg()).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+
+	_, err = repo.Add(testItem)
+	if err != ErrUserExists {
+		t.Errorf("expected ErrUserExists, got %v", err)
+		return
+	}
+
 	// query error
 	mock.
 		ExpectExec(`INSERT INTO users`).
-		WithArgs(1, password, 1).
+		WithArgs(login, sqlmock.AnyArg()).
 		WillReturnError(fmt.Errorf("bad query"))
 
-	err = repo.Add(testItem)
+	_, err = repo.Add(testItem)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -71,13 +99,13 @@ func TestAuthorize(t *testing.T) {
 	defer db.Close()
 
 	// good query
-	rows := sqlmock.NewRows([]string{"id", "login", "password"})
+	rows := sqlmock.NewRows(userRowColumns)
 	expect := []*User{
-		{1, "ayta", "123456789"},
-		{2, "qwe", "123456789"},
+		{ID: 1, Login: "ayta", Password: "123456789", Role: "user"},
+		{ID: 2, Login: "qwe", Password: "123456789", Role: "user"},
 	}
 	for _, user := range expect {
-		rows = rows.AddRow(user.ID, user.Login, user.Password)
+		rows = rows.AddRow(user.ID, user.Login, user.Password, user.Role, "", user.Disabled)
 	}
 
 	//testCase := []LoginCase{
@@ -86,36 +114,55 @@ func TestAuthorize(t *testing.T) {
 	//	//{"ayt", "123456789"},
 	//}
 	mock.
-		ExpectQuery("SELECT id, login, password FROM users WHERE").
+		ExpectQuery("SELECT (.+) FROM users WHERE").
 		WithArgs("ayta").
 		WillReturnRows(rows)
 	repo := &UsersMemoryRepository{
 		data:   db,
-		LastID: 1,
+		hasher: testHasher,
 	}
 
-	// good request
+	// good request, пароль в базе открытым текстом - перехешируется
+	mock.
+		ExpectExec("UPDATE users SET").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	item, err1 := repo.Authorize("ayta", "123456789")
 	if err1 != nil {
-		fmt.Println("error: ", err1)
+		t.Errorf("unexpected err: %s", err1)
 		return
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 		return
 	}
-	if !reflect.DeepEqual(item, expect[0]) {
+	if item.ID != expect[0].ID || item.Login != expect[0].Login || item.Password == expect[0].Password {
 		t.Errorf("results not match, want %v, have %v", expect[0], item)
 		return
 	}
 
+	// хеш актуален - без UPDATE
+	mock.
+		ExpectQuery("SELECT (.+) FROM users WHERE").
+		WithArgs("ayta").
+		WillReturnRows(sqlmock.NewRows(userRowColumns).AddRow(1, "ayta", item.Password, "user", "", false))
+	_, err1 = repo.Authorize("ayta", "123456789")
+	if err1 != nil {
+		t.Errorf("unexpected err: %s", err1)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
 	// invalid password
 	mock.
-		ExpectQuery("SELECT id, login, password FROM users WHERE").
+		ExpectQuery("SELECT (.+) FROM users WHERE").
 		WithArgs("ayta").
 		WillReturnRows(rows)
 
-	item, err1 = repo.Authorize("ayta", "12345679")
+	_, err1 = repo.Authorize("ayta", "12345679")
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 		return
@@ -123,11 +170,11 @@ func TestAuthorize(t *testing.T) {
 
 	//no user found
 	mock.
-		ExpectQuery("SELECT id, login, password FROM users WHERE").
+		ExpectQuery("SELECT (.+) FROM users WHERE").
 		WithArgs("aya").
 		WillReturnError(fmt.Errorf(" No user found"))
 
-	item, err1 = repo.Authorize("aya", "123456789")
+	_, err1 = repo.Authorize("aya", "123456789")
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 		return
@@ -142,23 +189,23 @@ func TestFind(t *testing.T) {
 	defer db.Close()
 
 	// good query
-	rows := sqlmock.NewRows([]string{"id", "login", "password"})
+	rows := sqlmock.NewRows(userRowColumns)
 	expect := []*User{
-		{1, "ayta", "123456789"},
-		{2, "aya", "123456789"},
+		{ID: 1, Login: "ayta", Password: "123456789", Role: "user"},
+		{ID: 2, Login: "aya", Password: "123456789", Role: "user"},
 	}
 	for _, user := range expect {
-		rows = rows.AddRow(user.ID, user.Login, user.Password)
+		rows = rows.AddRow(user.ID, user.Login, user.Password, user.Role, "", user.Disabled)
 	}
 
 	mock.
-		ExpectQuery("SELECT id, login, password FROM users WHERE").
+		ExpectQuery("SELECT (.+) FROM users WHERE").
 		WithArgs("ayta").
 		WillReturnRows(rows)
 
 	repo := &UsersMemoryRepository{
 		data:   db,
-		LastID: 1,
+		hasher: testHasher,
 	}
 
 	// good request
@@ -173,7 +220,7 @@ func TestFind(t *testing.T) {
 	}
 
 	mock.
-		ExpectQuery("SELECT id, login, password FROM users WHERE").
+		ExpectQuery("SELECT (.+) FROM users WHERE").
 		WithArgs("wqqew").
 		WillReturnError(fmt.Errorf(" No user found"))
 
@@ -193,25 +240,108 @@ func TestMemoryRepo(t *testing.T) {
 	defer db.Close()
 
 	// good query
-	rows := sqlmock.NewRows([]string{"id", "login", "password"})
+	rows := sqlmock.NewRows(userRowColumns)
 	expect := []*User{
-		{1, "ayta", "123456789"},
-		{2, "aya", "123456789"},
+		{ID: 1, Login: "ayta", Password: "123456789", Role: "user"},
+		{ID: 2, Login: "aya", Password: "123456789", Role: "user"},
 	}
 	for _, user := range expect {
-		rows = rows.AddRow(user.ID, user.Login, user.Password)
+		rows = rows.AddRow(user.ID, user.Login, user.Password, user.Role, "", user.Disabled)
 	}
 
 	repo := &UsersMemoryRepository{
 		data:   db,
-		LastID: 1,
+		hasher: testHasher,
 	}
 
 	// good request
-	item := NewMemoryRepo(db)
+	item := NewMemoryRepo(db, testHasher)
 	if !reflect.DeepEqual(item, repo) {
 		t.Errorf("results not match, want %v, have %v", item, repo)
 		return
 	}
 
 }
+
+func TestRolesAndDisable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UsersMemoryRepository{
+		data:   db,
+		hasher: testHasher,
+	}
+
+	// смена роли: категории пишутся одной строкой, запись перечитывается
+	mock.
+		ExpectExec("UPDATE users SET `role`").
+		WithArgs("moderator", "music,news", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectQuery("SELECT (.+) FROM users WHERE id").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(userRowColumns).AddRow(2, "qwe", "hash", "moderator", "music,news", false))
+
+	u, err := repo.SetRole(2, "moderator", []string{"music", "news"})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	want := &User{ID: 2, Login: "qwe", Password: "hash", Role: "moderator", Categories: []string{"music", "news"}}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("results not match, want %v, have %v", want, u)
+		return
+	}
+
+	// нет такого пользователя
+	mock.
+		ExpectExec("UPDATE users SET `disabled`").
+		WithArgs(true, 9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("SELECT (.+) FROM users WHERE id").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(userRowColumns))
+
+	_, err = repo.SetDisabled(9, true)
+	if err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+		return
+	}
+
+	// список
+	mock.
+		ExpectQuery("SELECT (.+) FROM users ORDER BY id").
+		WillReturnRows(sqlmock.NewRows(userRowColumns).
+			AddRow(1, "ayta", "hash", "admin", "", false).
+			AddRow(2, "qwe", "hash", "user", "", true))
+
+	list, err := repo.List()
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(list) != 2 || list[0].Role != "admin" || !list[1].Disabled || list[1].Categories != nil {
+		t.Errorf("results not match, have %v", list)
+		return
+	}
+
+	// заблокированный пользователь с верным паролем
+	hash, _ := testHasher.Hash("12345678")
+	mock.
+		ExpectQuery("SELECT (.+) FROM users WHERE login").
+		WithArgs("qwe").
+		WillReturnRows(sqlmock.NewRows(userRowColumns).AddRow(2, "qwe", hash, "user", "", true))
+
+	_, err = repo.Authorize("qwe", "12345678")
+	if err != ErrUserDisabled {
+		t.Errorf("expected ErrUserDisabled, got %v", err)
+		return
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}